@@ -10,8 +10,14 @@ func init() {
 	command.HandleCommand(&pkg.DictionaryCommand{})
 	command.HandleCommand(&pkg.TimeCommand{})
 	command.HandleCommand(&pkg.WeatherCommand{})
+	command.HandleCommand(&pkg.SunCommand{})
 	command.HandleCommand(&pkg.YoutubeCommand{})
 	command.HandleCommand(&pkg.UrbanCommand{})
 	command.HandleCommand(&pkg.WikiCommand{})
 	command.HandleCommand(&pkg.JokeCommand{})
+	command.HandleCommand(&pkg.CancelCommand{})
+	command.HandleCommand(&pkg.MoreCommand{})
+	command.HandleCommand(&pkg.HelpCommand{})
+	command.HandleCommand(&pkg.PreferencesCommand{})
+	command.HandleCommand(&pkg.StatusCommand{})
 }
@@ -0,0 +1,504 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/raf924/connector-sdk/domain"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertsFileKey is the ApiKeys entry naming the file the alert subscriptions of channels are persisted to
+const alertsFileKey = "alerts_file"
+
+const (
+	defaultAlertMinutes = 15
+	// maxChannelAlerts and maxAlertLocations bound the locations watched, each of them costing calls to the upstreams
+	maxChannelAlerts  = 5
+	maxAlertLocations = 100
+	// maxPendingAlerts bounds the alerts waiting for a chat message in a channel, the oldest being dropped
+	maxPendingAlerts = 10
+	// alertLookahead is how far the forecasts are watched for storms and heat
+	alertLookahead = 24 * time.Hour
+	// heatThreshold is the temperature, in Celsius, from which heat is warned about
+	heatThreshold = 35.0
+	// maxAlertDescription is the length of the description of an alert, beyond which it is cut
+	maxAlertDescription = 300
+)
+
+var _ alertProvider = (*openWeatherProvider)(nil)
+
+// WeatherAlert is a warning of severe weather at a location
+type WeatherAlert struct {
+	Event string
+	// Sender is the agency issuing the alert, empty when it was derived from a forecast
+	Sender      string
+	Description string
+	Start       time.Time
+	End         time.Time
+}
+
+// alertProvider is implemented by the WeatherProvider that can tell the alerts issued for a location
+type alertProvider interface {
+	Alerts(ctx context.Context, latitude float64, longitude float64, now time.Time) ([]WeatherAlert, error)
+}
+
+type oneCallResponse struct {
+	Alerts []struct {
+		SenderName  string `json:"sender_name"`
+		Event       string `json:"event"`
+		Start       int64  `json:"start"`
+		End         int64  `json:"end"`
+		Description string `json:"description"`
+	} `json:"alerts"`
+}
+
+// Alerts gets the alerts of the One Call API of OpenWeather, which needs a subscription besides the API key
+func (o *openWeatherProvider) Alerts(ctx context.Context, latitude float64, longitude float64, now time.Time) ([]WeatherAlert, error) {
+	if len(o.apiKey) == 0 {
+		return nil, missingApiKey(openWeatherUpstream)
+	}
+	oneCallUrl := endpointUrl(o.baseUrl, "data", "3.0", "onecall")
+	oneCallUrl.RawQuery = url.Values{
+		"lat":     {strconv.FormatFloat(latitude, 'f', 5, 64)},
+		"lon":     {strconv.FormatFloat(longitude, 'f', 5, 64)},
+		"exclude": {"current,minutely,hourly,daily"},
+		"appid":   {o.apiKey},
+	}.Encode()
+	var response oneCallResponse
+	if err := o.client.getJSON(ctx, oneCallUrl.String(), &response); err != nil {
+		return nil, upstreamError(openWeatherUpstream, err)
+	}
+	alerts := make([]WeatherAlert, 0, len(response.Alerts))
+	for _, alert := range response.Alerts {
+		alerts = append(alerts, WeatherAlert{
+			Event:       alert.Event,
+			Sender:      alert.SenderName,
+			Description: strings.TrimSpace(alert.Description),
+			Start:       time.Unix(alert.Start, 0).In(now.Location()),
+			End:         time.Unix(alert.End, 0).In(now.Location()),
+		})
+	}
+	return alerts, nil
+}
+
+// forecastAlerts derives alerts from the coming hours of a forecast, for the locations no agency issues alerts for
+func forecastAlerts(forecast *Forecast, now time.Time, units degree) []WeatherAlert {
+	var storm, heat *WeatherAlert
+	hottest := -math.MaxFloat64
+	for _, hour := range forecast.Hours {
+		if hour.Time.Before(now.Add(-time.Hour)) || hour.Time.After(now.Add(alertLookahead)) {
+			continue
+		}
+		if strings.Contains(hour.Sky, "thunderstorm") {
+			if storm == nil {
+				storm = &WeatherAlert{Event: "Thunderstorms", Description: hour.Sky + " expected", Start: hour.Time}
+			}
+			storm.End = hour.Time
+		}
+		if hour.Temperature >= heatThreshold {
+			if heat == nil {
+				heat = &WeatherAlert{Event: "Heat", Start: hour.Time}
+			}
+			heat.End = hour.Time
+			hottest = math.Max(hottest, hour.Temperature)
+		}
+	}
+	var alerts []WeatherAlert
+	if storm != nil {
+		alerts = append(alerts, *storm)
+	}
+	if heat != nil {
+		heat.Description = fmt.Sprintf("up to %0.1f°%s expected", units.convert(hottest), units)
+		alerts = append(alerts, *heat)
+	}
+	return alerts
+}
+
+// alertSubscription is a channel watching a location for severe weather
+type alertSubscription struct {
+	Channel string `json:"channel"`
+	Private bool   `json:"private,omitempty"`
+	// Nick and Id are the ones of the user private alerts are sent to
+	Nick string `json:"nick,omitempty"`
+	Id   string `json:"id,omitempty"`
+	// Subscriber identifies the user who subscribed, who can unsubscribe without being a moderator
+	Subscriber string  `json:"subscriber,omitempty"`
+	Location   string  `json:"location"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+}
+
+func (s alertSubscription) recipient() *domain.User {
+	if !s.Private {
+		return nil
+	}
+	return domain.NewUser(s.Nick, s.Id, domain.RegularUser)
+}
+
+// place identifies the location of s, subscriptions to the same place being checked once
+func (s alertSubscription) place() string {
+	return strconv.FormatFloat(s.Latitude, 'f', 2, 64) + "," + strconv.FormatFloat(s.Longitude, 'f', 2, 64)
+}
+
+// alertStore keeps the alert subscriptions of the channels and the alerts to deliver to them
+type alertStore struct {
+	m             sync.Mutex
+	subscriptions []alertSubscription
+	// sent are the alerts already delivered, keyed by place, event and day, until they end
+	sent map[string]time.Time
+	// pending are the alerts waiting for the next chat message of their channel, keyed by channel, when there is no sink
+	pending map[string][]*domain.ClientMessage
+	sink    func(message *domain.ClientMessage)
+	// filename is empty unless the subscriptions are persisted
+	filename string
+}
+
+var weatherAlerts = &alertStore{sent: map[string]time.Time{}, pending: map[string][]*domain.ClientMessage{}}
+
+// SetAlertsFile persists the alert subscriptions of channels to filename, loading the ones it already holds
+func SetAlertsFile(filename string) error {
+	var subscriptions []alertSubscription
+	content, err := ioutil.ReadFile(filename)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(content, &subscriptions); err != nil {
+			return fmt.Errorf("invalid alerts file %s: %w", filename, err)
+		}
+	}
+	weatherAlerts.m.Lock()
+	weatherAlerts.subscriptions = subscriptions
+	weatherAlerts.filename = filename
+	weatherAlerts.m.Unlock()
+	return nil
+}
+
+// SetAlertSink has weather alerts sent through sink as soon as they are issued.
+// The executor of the connector sdk cannot send messages on its own, so the commands cannot set a sink themselves:
+// without one set by the host, alerts are returned by the weather command in answer to the next chat message of their channel.
+func SetAlertSink(sink func(message *domain.ClientMessage)) {
+	weatherAlerts.m.Lock()
+	weatherAlerts.sink = sink
+	var pending map[string][]*domain.ClientMessage
+	if sink != nil {
+		pending = weatherAlerts.pending
+		weatherAlerts.pending = map[string][]*domain.ClientMessage{}
+	}
+	weatherAlerts.m.Unlock()
+	for _, messages := range pending {
+		for _, message := range messages {
+			sink(message)
+		}
+	}
+}
+
+// save must be called with s.m held
+func (s *alertStore) save() {
+	if len(s.filename) == 0 {
+		return
+	}
+	content, err := json.Marshal(s.subscriptions)
+	if err == nil {
+		err = writeFileAtomically(s.filename, content)
+	}
+	if err != nil {
+		currentLogger().Error("cannot save alert subscriptions", "filename", s.filename, "err", err)
+	}
+}
+
+func (s *alertStore) subscribe(subscription alertSubscription) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	places := map[string]bool{}
+	count := 0
+	for _, existing := range s.subscriptions {
+		places[existing.place()] = true
+		if existing.Channel != subscription.Channel {
+			continue
+		}
+		if existing.place() == subscription.place() {
+			return badInput("Already watching %s", existing.Location)
+		}
+		count++
+	}
+	if count >= maxChannelAlerts {
+		return badInput("Cannot watch more than %d locations, unsubscribe from one first", maxChannelAlerts)
+	}
+	if !places[subscription.place()] && len(places) >= maxAlertLocations {
+		return badInput("Too many locations are watched already")
+	}
+	s.subscriptions = append(s.subscriptions, subscription)
+	s.save()
+	return nil
+}
+
+// unsubscribe removes the subscriptions of channel whose location starts with location that allowed accepts,
+// returning the locations removed and the ones matching that were kept
+func (s *alertStore) unsubscribe(channel string, location string, allowed func(subscription alertSubscription) bool) ([]string, []string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var removed, denied []string
+	kept := s.subscriptions[:0]
+	for _, subscription := range s.subscriptions {
+		if subscription.Channel == channel && strings.HasPrefix(strings.ToLower(subscription.Location), strings.ToLower(location)) {
+			if allowed(subscription) {
+				removed = append(removed, subscription.Location)
+				continue
+			}
+			denied = append(denied, subscription.Location)
+		}
+		kept = append(kept, subscription)
+	}
+	s.subscriptions = kept
+	if len(removed) > 0 {
+		s.save()
+	}
+	return removed, denied
+}
+
+func (s *alertStore) of(channel string) []alertSubscription {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var subscriptions []alertSubscription
+	for _, subscription := range s.subscriptions {
+		if subscription.Channel == channel {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions
+}
+
+// places returns a subscription of every place watched
+func (s *alertStore) places() []alertSubscription {
+	s.m.Lock()
+	defer s.m.Unlock()
+	seen := map[string]bool{}
+	var places []alertSubscription
+	for _, subscription := range s.subscriptions {
+		if !seen[subscription.place()] {
+			seen[subscription.place()] = true
+			places = append(places, subscription)
+		}
+	}
+	return places
+}
+
+// deliver sends alert to the channels watching place, unless it was already
+func (s *alertStore) deliver(place string, alert WeatherAlert, render func(location string) string) {
+	s.m.Lock()
+	key := place + "|" + strings.ToLower(alert.Event) + "|" + alert.Start.Format("2006-01-02")
+	if _, ok := s.sent[key]; ok {
+		s.m.Unlock()
+		return
+	}
+	until := alert.End
+	if until.Before(alert.Start) {
+		until = alert.Start
+	}
+	s.sent[key] = until.Add(alertLookahead)
+	var messages []*domain.ClientMessage
+	for _, subscription := range s.subscriptions {
+		if subscription.place() != place {
+			continue
+		}
+		message := domain.NewClientMessage(render(subscription.Location), subscription.recipient(), subscription.Private)
+		if s.sink == nil {
+			pending := append(s.pending[subscription.Channel], message)
+			if len(pending) > maxPendingAlerts {
+				pending = pending[len(pending)-maxPendingAlerts:]
+			}
+			s.pending[subscription.Channel] = pending
+		}
+		messages = append(messages, message)
+	}
+	sink := s.sink
+	s.m.Unlock()
+	if sink != nil {
+		for _, message := range messages {
+			sink(message)
+		}
+	}
+}
+
+// forget drops the delivered alerts that are over
+func (s *alertStore) forget(now time.Time) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for key, until := range s.sent {
+		if until.Before(now) {
+			delete(s.sent, key)
+		}
+	}
+}
+
+func (s *alertStore) takePending(channel string) []*domain.ClientMessage {
+	s.m.Lock()
+	defer s.m.Unlock()
+	pending := s.pending[channel]
+	delete(s.pending, channel)
+	return pending
+}
+
+// fetchAlerts returns the alerts issued for a location by the first provider able to tell them,
+// or the ones derived from the forecast if none is
+func (w *WeatherCommand) fetchAlerts(ctx context.Context, latitude float64, longitude float64, now time.Time) ([]WeatherAlert, error) {
+	settings := w.settings()
+	for _, provider := range settings.providers {
+		alerter, ok := provider.(alertProvider)
+		if !ok {
+			continue
+		}
+		alerts, err := alerter.Alerts(ctx, latitude, longitude, now)
+		if err == nil {
+			return alerts, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		loggerFrom(ctx).Debug("no alerts from the provider, deriving them from the forecast", "provider", provider.Name(), "err", err)
+	}
+	forecast, err := forecastWithFallback(ctx, settings.providers, latitude, longitude, now)
+	if err != nil {
+		return nil, err
+	}
+	units := defaultDegreeType
+	if settings.units == "imperial" {
+		units = Imperial
+	}
+	return forecastAlerts(forecast, now, units), nil
+}
+
+// alertLimits are the limits of the upstreams reached when checking the alerts of a place
+func (w *WeatherCommand) alertLimits() map[string]RateLimit {
+	upstreams := []string{timeApiUpstream}
+	for _, provider := range w.settings().providers {
+		upstreams = append(upstreams, provider.Name())
+	}
+	return upstreamLimits(upstreams)
+}
+
+// checkAlerts fetches the alerts of every place watched and delivers the new ones.
+// The places the upstreams cannot be called for without exceeding their rate limits wait for the next check.
+func (w *WeatherCommand) checkAlerts() {
+	logger := currentLogger().With("command", w.Name())
+	for _, place := range weatherAlerts.places() {
+		if allowed, wait := limiter.take(w.alertLimits()); !allowed {
+			logger.Info("weather alerts check rate limited", "location", place.Location, "wait", wait)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(withLogger(rootContext, logger), weatherTimeout)
+		now, err := w.fetchLocationTime(ctx, place.Latitude, place.Longitude)
+		if err != nil {
+			now = time.Now().In(estimatedZone(place.Longitude))
+		}
+		alerts, err := w.fetchAlerts(ctx, place.Latitude, place.Longitude, now)
+		cancel()
+		if err != nil {
+			logger.Warn("cannot check weather alerts", "location", place.Location, "err", err)
+			continue
+		}
+		for _, alert := range alerts {
+			if alert.End.After(alert.Start) && alert.End.Before(now) {
+				continue
+			}
+			weatherAlerts.deliver(place.place(), alert, func(location string) string {
+				return w.renderAlert(location, alert)
+			})
+		}
+	}
+	weatherAlerts.forget(time.Now())
+}
+
+// watchAlerts checks the alerts of the places watched until Shutdown is called
+func (w *WeatherCommand) watchAlerts() {
+	for {
+		select {
+		case <-rootContext.Done():
+			return
+		case <-time.After(w.settings().alertInterval):
+			w.checkAlerts()
+		}
+	}
+}
+
+func (w *WeatherCommand) renderAlert(location string, alert WeatherAlert) string {
+	when := "from " + alert.Start.Format("Mon 15:04")
+	if alert.End.After(alert.Start) {
+		when += " to " + alert.End.Format("Mon 15:04")
+	}
+	description := alert.Description
+	if len(description) > maxAlertDescription {
+		description = truncate(description, maxAlertDescription) + "..."
+	}
+	if len(alert.Sender) > 0 {
+		description += " (" + alert.Sender + ")"
+	}
+	return Reply{
+		Heading("Weather alert for " + location),
+		Field{Name: alert.Event, Value: when + " -- " + description},
+	}.Render(w.renderer)
+}
+
+// manageAlerts handles the subscribe and unsubscribe subcommands of weather
+func (w *WeatherCommand) manageAlerts(ctx context.Context, command *domain.CommandMessage, action string, city []string) (Reply, error) {
+	channel := channelOf(command.Sender(), command.Private())
+	search := strings.Join(city, " ")
+	if action == "unsubscribe" {
+		if len(search) == 0 {
+			return nil, badInput("Which location? e.g. %s%s unsubscribe paris", w.trigger, w.Name())
+		}
+		sender := userKey(command.Sender())
+		moderator := w.executor.UserHasPermission(command.Sender(), domain.NeedModerator)
+		removed, denied := weatherAlerts.unsubscribe(channel, search, func(subscription alertSubscription) bool {
+			return subscription.Private || subscription.Subscriber == sender || moderator
+		})
+		switch {
+		case len(removed) > 0:
+		case len(denied) > 0:
+			return nil, badInput("Only who subscribed to %s or a moderator can unsubscribe from it", strings.Join(denied, ", "))
+		default:
+			return nil, notFound("Not watching %q", search)
+		}
+		return Reply{Text("No more alerts for " + strings.Join(removed, ", "))}, nil
+	}
+	if len(city) == 0 {
+		subscriptions := weatherAlerts.of(channel)
+		if len(subscriptions) == 0 {
+			return Reply{Text(fmt.Sprintf("Not watching any location, use %s%s subscribe <city>", w.trigger, w.Name()))}, nil
+		}
+		locations := make([]string, len(subscriptions))
+		for i, subscription := range subscriptions {
+			locations[i] = subscription.Location
+		}
+		return Reply{Heading("Weather alerts for"), List(locations)}, nil
+	}
+	loc, err := w.fetchLocation(ctx, search)
+	if err != nil {
+		return nil, err
+	}
+	subscription := alertSubscription{
+		Channel:    channel,
+		Private:    command.Private(),
+		Subscriber: userKey(command.Sender()),
+		Location:   loc.name + ", " + loc.country,
+		Latitude:   loc.latitude,
+		Longitude:  loc.longitude,
+	}
+	if command.Private() {
+		subscription.Nick, subscription.Id = command.Sender().Nick(), command.Sender().Id()
+	}
+	if err := weatherAlerts.subscribe(subscription); err != nil {
+		return nil, err
+	}
+	return Reply{Text(fmt.Sprintf("Watching %s, severe weather will be announced here", subscription.Location))}, nil
+}
@@ -0,0 +1,52 @@
+package pkg
+
+import (
+	"github.com/raf924/connector-sdk/domain"
+	"testing"
+	"time"
+)
+
+func TestForecastAlerts(t *testing.T) {
+	now := time.Date(2026, 7, 18, 12, 0, 0, 0, time.UTC)
+	forecast := &Forecast{Hours: []HourForecast{
+		{Time: now.Add(-3 * time.Hour), Temperature: 40, Sky: "thunderstorm"},
+		{Time: now.Add(3 * time.Hour), Temperature: 36, Sky: "thunderstorm with rain"},
+		{Time: now.Add(6 * time.Hour), Temperature: 37.5, Sky: "clear sky"},
+		{Time: now.Add(9 * time.Hour), Temperature: 30, Sky: "thunderstorm"},
+		{Time: now.Add(30 * time.Hour), Temperature: 45, Sky: "clear sky"},
+	}}
+	alerts := forecastAlerts(forecast, now, Metrics)
+	if len(alerts) != 2 {
+		t.Fatalf("forecastAlerts() = %+v, want a storm and heat", alerts)
+	}
+	if storm := alerts[0]; storm.Event != "Thunderstorms" || !storm.Start.Equal(now.Add(3*time.Hour)) || !storm.End.Equal(now.Add(9*time.Hour)) {
+		t.Errorf("storm = %+v, want it from 15:00 to 21:00", storm)
+	}
+	if heat := alerts[1]; heat.Event != "Heat" || heat.Description != "up to 37.5°C expected" || !heat.End.Equal(now.Add(6*time.Hour)) {
+		t.Errorf("heat = %+v, want up to 37.5°C until 18:00", heat)
+	}
+	if alerts := forecastAlerts(&Forecast{Hours: []HourForecast{{Time: now, Temperature: 20, Sky: "clear sky"}}}, now, Metrics); len(alerts) != 0 {
+		t.Errorf("forecastAlerts() = %+v, want none for fair weather", alerts)
+	}
+}
+
+func TestAlertStoreDeliversOnce(t *testing.T) {
+	store := &alertStore{sent: map[string]time.Time{}, pending: map[string][]*domain.ClientMessage{}}
+	paris := alertSubscription{Channel: "public", Location: "Paris, France", Latitude: 48.8566, Longitude: 2.3522}
+	store.subscriptions = []alertSubscription{paris, {Channel: "private:1", Private: true, Nick: "alice", Id: "1", Location: "Paris", Latitude: 48.857, Longitude: 2.352}}
+	alert := WeatherAlert{Event: "Heat", Start: time.Now()}
+	render := func(location string) string { return "Heat in " + location }
+	store.deliver(paris.place(), alert, render)
+	store.deliver(paris.place(), alert, render)
+	public := store.takePending("public")
+	if len(public) != 1 || public[0].Message() != "Heat in Paris, France" {
+		t.Errorf("public alerts = %v, want the alert delivered once", public)
+	}
+	private := store.takePending("private:1")
+	if len(private) != 1 || private[0].Message() != "Heat in Paris" || !private[0].Private() || private[0].Recipient().Id() != "1" {
+		t.Errorf("private alerts = %v, want the alert sent to alice in private", private)
+	}
+	if pending := store.takePending("public"); len(pending) != 0 {
+		t.Errorf("public alerts = %v once taken, want none", pending)
+	}
+}
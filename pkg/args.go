@@ -0,0 +1,247 @@
+package pkg
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type optionKind int
+
+const (
+	stringOption optionKind = iota
+	intOption
+	boolOption
+)
+
+// commandOption is a flag a command accepts, given either as "--name=value", "--name value" or "-short value".
+// Boolean options take no value.
+type commandOption struct {
+	name  string
+	short string
+	kind  optionKind
+	// choices restricts the values of the option, if not empty
+	choices []string
+	// min and max bound the values of int options, when max is greater than min
+	min, max int
+}
+
+// usage returns how option is written, e.g. "[--units=metric|imperial]"
+func (o commandOption) usage() string {
+	flag := "--" + o.name
+	if len(o.short) > 0 {
+		flag = "-" + o.short + "|" + flag
+	}
+	switch {
+	case o.kind == boolOption:
+	case len(o.choices) > 0:
+		flag += "=" + strings.Join(o.choices, "|")
+	case o.kind == intOption:
+		flag += "=<n>"
+	default:
+		flag += "=<" + o.name + ">"
+	}
+	return "[" + flag + "]"
+}
+
+// optionsUsage returns the usage of every option, to be appended to the usage of a command
+func optionsUsage(options []commandOption) string {
+	usages := make([]string, len(options))
+	for i, o := range options {
+		usages[i] = o.usage()
+	}
+	return strings.Join(usages, " ")
+}
+
+// arguments are the parsed arguments of a command
+type arguments struct {
+	positional []string
+	values     map[string]string
+}
+
+// text returns the positional arguments joined by spaces
+func (a *arguments) text() string {
+	return strings.Join(a.positional, " ")
+}
+
+// string returns the value of the option named name, or fallback if it was not given
+func (a *arguments) string(name string, fallback string) string {
+	if value, ok := a.values[name]; ok {
+		return value
+	}
+	return fallback
+}
+
+// int returns the value of the int option named name, or fallback if it was not given
+func (a *arguments) int(name string, fallback int) int {
+	value, ok := a.values[name]
+	if !ok {
+		return fallback
+	}
+	// values were validated while parsing
+	i, _ := strconv.Atoi(value)
+	return i
+}
+
+// bool tells whether the boolean option named name was given
+func (a *arguments) bool(name string) bool {
+	_, ok := a.values[name]
+	return ok
+}
+
+// parseArgs splits argString into positional arguments and the given options.
+// Dashed words that are not among the options, e.g. the exclusions of a search, are positional arguments.
+// Phrases between double or single quotes are kept as a single argument, and "--" ends the options.
+func parseArgs(argString string, options ...commandOption) (*arguments, error) {
+	tokens, err := tokenize(argString)
+	if err != nil {
+		return nil, err
+	}
+	args := &arguments{values: map[string]string{}}
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.flag && token.text == "--" {
+			for _, rest := range tokens[i+1:] {
+				args.positional = append(args.positional, rest.text)
+			}
+			break
+		}
+		o, value, hasValue, ok := token.option(options)
+		if !ok {
+			args.positional = append(args.positional, token.text)
+			continue
+		}
+		if o.kind == boolOption {
+			if hasValue {
+				return nil, badInput("Option --%s takes no value", o.name)
+			}
+			args.values[o.name] = ""
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(tokens) {
+				return nil, badInput("Option --%s needs a value", o.name)
+			}
+			if _, _, _, isOption := tokens[i+1].option(options); isOption {
+				return nil, badInput("Option --%s needs a value", o.name)
+			}
+			i++
+			value = tokens[i].text
+		}
+		if err := o.validate(value); err != nil {
+			return nil, err
+		}
+		args.values[o.name] = value
+	}
+	return args, nil
+}
+
+func findOption(options []commandOption, name string, short bool) (commandOption, bool) {
+	for _, o := range options {
+		if (short && o.short == name) || (!short && o.name == name) {
+			return o, true
+		}
+	}
+	return commandOption{}, false
+}
+
+func (o commandOption) validate(value string) error {
+	if len(value) == 0 {
+		return badInput("Option --%s needs a value", o.name)
+	}
+	if len(o.choices) > 0 {
+		for _, choice := range o.choices {
+			if strings.EqualFold(choice, value) {
+				return nil
+			}
+		}
+		return badInput("Option --%s must be one of %s", o.name, strings.Join(o.choices, ", "))
+	}
+	if o.kind == intOption {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return badInput("Option --%s must be a number", o.name)
+		}
+		if o.max > o.min && (i < o.min || i > o.max) {
+			return badInput("Option --%s must be between %d and %d", o.name, o.min, o.max)
+		}
+	}
+	return nil
+}
+
+type token struct {
+	text string
+	// flag is true for unquoted tokens starting with a dash, negative numbers aside
+	flag bool
+}
+
+// option returns the option among options that t is, with the value given along with it, if it is one
+func (t token) option(options []commandOption) (o commandOption, value string, hasValue bool, ok bool) {
+	if !t.flag {
+		return commandOption{}, "", false, false
+	}
+	name := strings.TrimLeft(t.text, "-")
+	if equal := strings.Index(name, "="); equal >= 0 {
+		name, value, hasValue = name[:equal], name[equal+1:], true
+	}
+	o, ok = findOption(options, name, !strings.HasPrefix(t.text, "--"))
+	return o, value, hasValue, ok
+}
+
+// endsWord tells whether the rune at i of runes is the last of a word
+func endsWord(runes []rune, i int) bool {
+	return i+1 == len(runes) || unicode.IsSpace(runes[i+1])
+}
+
+// opensPhrase tells whether the single quote at i of runes opens a phrase, which takes an apostrophe ending a later word.
+// Otherwise, e.g. in "'90s" or "rock 'n' roll", it is an apostrophe.
+func opensPhrase(runes []rune, i int) bool {
+	spaced := false
+	for j := i + 1; j < len(runes); j++ {
+		switch {
+		case unicode.IsSpace(runes[j]):
+			spaced = true
+		case runes[j] == '\'' && endsWord(runes, j):
+			return spaced
+		}
+	}
+	return false
+}
+
+// tokenize splits s on spaces, except within quotes
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	var current strings.Builder
+	var quote rune
+	inToken, quoted := false, false
+	runes := []rune(s)
+	flush := func() {
+		if inToken {
+			text := current.String()
+			flag := !quoted && len(text) > 1 && text[0] == '-' && !unicode.IsDigit(rune(text[1]))
+			tokens = append(tokens, token{text: text, flag: flag})
+		}
+		current.Reset()
+		inToken, quoted = false, false
+	}
+	for i, r := range runes {
+		switch {
+		case quote == '"' && r == quote, quote == '\'' && r == quote && endsWord(runes, i):
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"', r == '\'' && !inToken && opensPhrase(runes, i):
+			quote, inToken, quoted = r, true, true
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, badInput("Missing closing quote (%c)", quote)
+	}
+	flush()
+	return tokens, nil
+}
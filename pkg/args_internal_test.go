@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testOptions = []commandOption{
+	{name: "lang", short: "l", kind: stringOption},
+	{name: "count", short: "n", kind: intOption, min: 1, max: 10},
+	{name: "units", kind: stringOption, choices: []string{"metric", "imperial"}},
+	{name: "details", short: "d", kind: boolOption},
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		argString  string
+		positional []string
+		values     map[string]string
+	}{
+		{"new york", []string{"new", "york"}, map[string]string{}},
+		{`"new york" --lang=fr`, []string{"new york"}, map[string]string{"lang": "fr"}},
+		{"-l fr -n 3 -d go", []string{"go"}, map[string]string{"lang": "fr", "count": "3", "details": ""}},
+		{"--units imperial paris", []string{"paris"}, map[string]string{"units": "imperial"}},
+		{"golang -rust --", []string{"golang", "-rust"}, map[string]string{}},
+		{"-- --lang fr", []string{"--lang", "fr"}, map[string]string{}},
+		{"temperature -5", []string{"temperature", "-5"}, map[string]string{}},
+		{"'90s music", []string{"'90s", "music"}, map[string]string{}},
+		{"rock 'n' roll", []string{"rock", "'n'", "roll"}, map[string]string{}},
+		{"'rock and roll' it's", []string{"rock and roll", "it's"}, map[string]string{}},
+	}
+	for _, test := range tests {
+		args, err := parseArgs(test.argString, testOptions...)
+		if err != nil {
+			t.Errorf("parseArgs(%q) error = %v", test.argString, err)
+			continue
+		}
+		if !reflect.DeepEqual(args.positional, test.positional) || !reflect.DeepEqual(args.values, test.values) {
+			t.Errorf("parseArgs(%q) = %q %v, want %q %v", test.argString, args.positional, args.values, test.positional, test.values)
+		}
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	tests := map[string]string{
+		"--lang":             "Option --lang needs a value",
+		"--lang --details":   "Option --lang needs a value",
+		"--details=yes":      "Option --details takes no value",
+		"-n many":            "Option --count must be a number",
+		"-n 11":              "Option --count must be between 1 and 10",
+		"--units kelvin":     "Option --units must be one of metric, imperial",
+		`"unfinished phrase`: "Missing closing quote (\")",
+	}
+	for argString, want := range tests {
+		_, err := parseArgs(argString, testOptions...)
+		var typed *Error
+		if !errors.As(err, &typed) || typed.Kind != BadInput || typed.Reason != want {
+			t.Errorf("parseArgs(%q) error = %v, want %q", argString, err, want)
+		}
+	}
+}
+
+func TestArgumentsAccessors(t *testing.T) {
+	args, err := parseArgs("go -n 3", testOptions...)
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if args.text() != "go" || args.int("count", 5) != 3 || args.string("lang", "en") != "en" || args.bool("details") {
+		t.Errorf("arguments = %q %v, want go counted 3 times in the default language", args.positional, args.values)
+	}
+	if usage := optionsUsage(testOptions); usage != "[-l|--lang=<lang>] [-n|--count=<n>] [--units=metric|imperial] [-d|--details]" {
+		t.Errorf("optionsUsage() = %s", usage)
+	}
+}
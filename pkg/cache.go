@@ -0,0 +1,222 @@
+package pkg
+
+import (
+	"container/list"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheCapacity = 1024
+	// cachePersistDelay is how long the changes of a persisted cache are gathered before being written at once
+	cachePersistDelay = 10 * time.Second
+)
+
+// Cache stores upstream responses for a limited time.
+// Implementations must be safe for concurrent use as a single Cache is shared by all the commands in pkg.
+type Cache interface {
+	// Get returns the value stored under key if it has not expired yet
+	Get(key string) ([]byte, bool)
+	// Set stores value under key for ttl
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+var (
+	cacheLock     sync.RWMutex
+	responseCache Cache = NewMemoryCache(defaultCacheCapacity)
+)
+
+// SetCache replaces the cache used by the commands, e.g. with a persistent one.
+// The replaced cache is persisted one last time if it is.
+func SetCache(cache Cache) {
+	cacheLock.Lock()
+	previous := responseCache
+	responseCache = cache
+	cacheLock.Unlock()
+	persistCache(previous)
+}
+
+// persistCache writes the entries of cache to its file at once if it has one, rather than waiting for cachePersistDelay
+func persistCache(cache Cache) {
+	if memory, ok := cache.(*memoryCache); ok && len(memory.filename) > 0 {
+		memory.persist()
+	}
+}
+
+// configuredCache returns the cache of the Config persisted to filename, or kept in memory if filename is empty
+func configuredCache(filename string) (Cache, error) {
+	if len(filename) == 0 {
+		return NewMemoryCache(defaultCacheCapacity), nil
+	}
+	return NewFileCache(filename, defaultCacheCapacity)
+}
+
+func currentCache() Cache {
+	cacheLock.RLock()
+	defer cacheLock.RUnlock()
+	return responseCache
+}
+
+// cacheKey normalizes the parts of a query so that equivalent queries share their cache entry
+func cacheKey(parts ...string) string {
+	normalized := make([]string, len(parts))
+	for i, part := range parts {
+		normalized[i] = strings.Join(strings.Fields(strings.ToLower(part)), " ")
+	}
+	return strings.Join(normalized, "|")
+}
+
+// cached fills v with the value stored under key or, if there is none, calls fetch to fill it and stores it for ttl
+func cached(key string, ttl time.Duration, v interface{}, fetch func() error) error {
+	cache := currentCache()
+	if ttl <= 0 || cache == nil {
+		return fetch()
+	}
+	// keys start with the name of the upstream the value comes from
+	upstream := strings.SplitN(key, "|", 2)[0]
+	if value, ok := cache.Get(key); ok {
+		if err := json.Unmarshal(value, v); err == nil {
+			cacheLookups.inc(upstream, "hit")
+			return nil
+		}
+	}
+	cacheLookups.inc(upstream, "miss")
+	if err := fetch(); err != nil {
+		return err
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		currentLogger().Warn("cannot cache", "key", key, "err", err)
+		return nil
+	}
+	cache.Set(key, value, ttl)
+	return nil
+}
+
+type cacheEntry struct {
+	Key       string    `json:"key"`
+	Value     []byte    `json:"value"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+var _ Cache = (*memoryCache)(nil)
+
+// memoryCache is a LRU cache whose entries expire
+type memoryCache struct {
+	m        sync.Mutex
+	capacity int
+	entries  *list.List
+	index    map[string]*list.Element
+	// filename is empty unless the cache is persisted
+	filename string
+	// persistTimer is set while changes wait to be persisted
+	persistTimer *time.Timer
+	// persistLock keeps the snapshots written in the order they are taken
+	persistLock sync.Mutex
+}
+
+// NewMemoryCache returns an in-memory Cache holding at most capacity entries, evicting the least recently used ones first
+func NewMemoryCache(capacity int) Cache {
+	return newMemoryCache(capacity, "")
+}
+
+// NewFileCache returns a Cache like NewMemoryCache's that is persisted to filename so that it survives restarts.
+// Changes are written cachePersistDelay after they happen, and when the cache is replaced or pkg is Shutdown.
+func NewFileCache(filename string, capacity int) (Cache, error) {
+	cache := newMemoryCache(capacity, filename)
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []cacheEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		// a corrupted file only means starting with an empty cache
+		currentLogger().Warn("cannot load cache", "filename", filename, "err", err)
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.ExpiresAt.After(now) && cache.entries.Len() < capacity {
+			cache.index[entry.Key] = cache.entries.PushBack(&cacheEntry{Key: entry.Key, Value: entry.Value, ExpiresAt: entry.ExpiresAt})
+		}
+	}
+	return cache, nil
+}
+
+func newMemoryCache(capacity int, filename string) *memoryCache {
+	return &memoryCache{
+		capacity: capacity,
+		entries:  list.New(),
+		index:    map[string]*list.Element{},
+		filename: filename,
+	}
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	element, ok := c.index[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.ExpiresAt) {
+		c.entries.Remove(element)
+		delete(c.index, key)
+		return nil, false
+	}
+	c.entries.MoveToFront(element)
+	return entry.Value, true
+}
+
+func (c *memoryCache) Set(key string, value []byte, ttl time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	entry := &cacheEntry{Key: key, Value: value, ExpiresAt: time.Now().Add(ttl)}
+	if element, ok := c.index[key]; ok {
+		element.Value = entry
+		c.entries.MoveToFront(element)
+	} else {
+		c.index[key] = c.entries.PushFront(entry)
+	}
+	for c.entries.Len() > c.capacity {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.index, oldest.Value.(*cacheEntry).Key)
+	}
+	if len(c.filename) > 0 && c.persistTimer == nil {
+		c.persistTimer = time.AfterFunc(cachePersistDelay, c.persist)
+	}
+}
+
+// persist atomically replaces the file of the cache with the entries that have not expired yet
+func (c *memoryCache) persist() {
+	c.persistLock.Lock()
+	defer c.persistLock.Unlock()
+	c.m.Lock()
+	if c.persistTimer != nil {
+		c.persistTimer.Stop()
+		c.persistTimer = nil
+	}
+	now := time.Now()
+	snapshot := make([]cacheEntry, 0, c.entries.Len())
+	for element := c.entries.Front(); element != nil; element = element.Next() {
+		if entry := element.Value.(*cacheEntry); entry.ExpiresAt.After(now) {
+			snapshot = append(snapshot, *entry)
+		}
+	}
+	c.m.Unlock()
+	content, err := json.Marshal(snapshot)
+	if err == nil {
+		err = writeFileAtomically(c.filename, content)
+	}
+	if err != nil {
+		currentLogger().Warn("cannot persist cache", "filename", c.filename, "err", err)
+	}
+}
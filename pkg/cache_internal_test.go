@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheExpires(t *testing.T) {
+	cache := NewMemoryCache(10)
+	cache.Set("fresh", []byte("1"), time.Minute)
+	cache.Set("stale", []byte("2"), -time.Second)
+	if value, ok := cache.Get("fresh"); !ok || string(value) != "1" {
+		t.Errorf("Get(fresh) = %q, %v, want 1", value, ok)
+	}
+	if value, ok := cache.Get("stale"); ok {
+		t.Errorf("Get(stale) = %q, want it expired", value)
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewMemoryCache(2)
+	cache.Set("a", []byte("a"), time.Minute)
+	cache.Set("b", []byte("b"), time.Minute)
+	cache.Get("a")
+	cache.Set("c", []byte("c"), time.Minute)
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("Get(b) found it, want it evicted as the least recently used")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Get(%s) found nothing, want it kept", key)
+		}
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cache.json")
+	cache, err := NewFileCache(filename, 10)
+	if err != nil {
+		t.Fatalf("NewFileCache() error = %v", err)
+	}
+	cache.Set("kept", []byte("1"), time.Minute)
+	cache.Set("expired", []byte("2"), -time.Second)
+	persistCache(cache)
+	reloaded, err := NewFileCache(filename, 10)
+	if err != nil {
+		t.Fatalf("NewFileCache() error = %v", err)
+	}
+	if value, ok := reloaded.Get("kept"); !ok || string(value) != "1" {
+		t.Errorf("Get(kept) = %q, %v, want it persisted", value, ok)
+	}
+	if _, ok := reloaded.Get("expired"); ok {
+		t.Errorf("Get(expired) found it, want it left out of the file")
+	}
+}
+
+func TestFileCachePersistsOnceAfterDelay(t *testing.T) {
+	cache := newMemoryCache(10, filepath.Join(t.TempDir(), "cache.json"))
+	cache.Set("a", []byte("a"), time.Minute)
+	timer := cache.persistTimer
+	cache.Set("b", []byte("b"), time.Minute)
+	if timer == nil || cache.persistTimer != timer {
+		t.Fatalf("persist timer = %v then %v, want the changes gathered by a single one", timer, cache.persistTimer)
+	}
+	cache.persist()
+	if cache.persistTimer != nil {
+		t.Errorf("persist timer = %v once persisted, want none", cache.persistTimer)
+	}
+}
+
+func TestSetConfigCacheFile(t *testing.T) {
+	previous, previousCache := currentConfig, currentCache()
+	t.Cleanup(func() {
+		_ = SetConfig(previous)
+		SetCache(previousCache)
+	})
+	config := previous
+	config.Cache.File = filepath.Join(t.TempDir(), "cache.json")
+	if err := SetConfig(config); err != nil {
+		t.Fatalf("SetConfig() error = %v", err)
+	}
+	if cache, ok := currentCache().(*memoryCache); !ok || cache.filename != config.Cache.File {
+		t.Errorf("cache = %#v, want one persisted to %s", currentCache(), config.Cache.File)
+	}
+}
+
+func TestCached(t *testing.T) {
+	previous := currentCache()
+	SetCache(NewMemoryCache(10))
+	t.Cleanup(func() { SetCache(previous) })
+	fetches := 0
+	fetch := func(v *string) func() error {
+		return func() error {
+			fetches++
+			*v = "value"
+			return nil
+		}
+	}
+	var first, second string
+	if err := cached(cacheKey("wikipedia", "Go  Lang"), time.Minute, &first, fetch(&first)); err != nil || first != "value" {
+		t.Fatalf("cached() = %q, %v, want the fetched value", first, err)
+	}
+	if err := cached(cacheKey("wikipedia", "go lang"), time.Minute, &second, fetch(&second)); err != nil || second != "value" || fetches != 1 {
+		t.Errorf("cached() = %q, %v after %d fetches, want the value of the equivalent query without fetching it again", second, err, fetches)
+	}
+	failure := errors.New("unavailable")
+	if err := cached(cacheKey("wikipedia", "rust"), time.Minute, &first, func() error { return failure }); err != failure {
+		t.Errorf("cached() error = %v, want the one of fetch", err)
+	}
+}
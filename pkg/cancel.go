@@ -0,0 +1,50 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/raf924/connector-sdk/command"
+	"github.com/raf924/connector-sdk/domain"
+)
+
+var _ command.Command = (*CancelCommand)(nil)
+var _ Helper = (*CancelCommand)(nil)
+
+// CancelCommand cancels the commands its sender is still waiting on
+type CancelCommand struct {
+	command.NoOpInterceptor
+}
+
+func (c *CancelCommand) Init(executor command.Executor) error {
+	return setUp(executor)
+}
+
+func (c *CancelCommand) Name() string {
+	return "cancel"
+}
+
+func (c *CancelCommand) Aliases() []string {
+	return []string{"stop"}
+}
+
+func (c *CancelCommand) Usage() string {
+	return ""
+}
+
+func (c *CancelCommand) Description() string {
+	return "Cancels your commands that are still running"
+}
+
+func (c *CancelCommand) Examples() []string {
+	return nil
+}
+
+func (c *CancelCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	cancelled := runningInvocations.cancel(command.Sender())
+	reply := "Nothing to cancel"
+	if cancelled > 0 {
+		reply = fmt.Sprintf("Cancelled %d running command(s)", cancelled)
+	}
+	return []*domain.ClientMessage{
+		domain.NewClientMessage(reply, command.Sender(), command.Private()),
+	}, nil
+}
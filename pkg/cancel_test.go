@@ -0,0 +1,42 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"github.com/raf924/connector-sdk/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCancelCommandWithNothingRunning(t *testing.T) {
+	_, executor := newServer(t)
+	cancel := &pkg.CancelCommand{}
+	initCommand(t, cancel, executor)
+	assertTexts(t, run(t, cancel, servicetest.NewUser("alice"), "", false), "Nothing to cancel")
+}
+
+func TestCancelCommand(t *testing.T) {
+	_, executor := newServer(t)
+	// qwant answers once the search is cancelled
+	arrived := make(chan struct{})
+	stalled := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		close(arrived)
+		<-request.Context().Done()
+	}))
+	defer stalled.Close()
+	executor.Keys[pkg.EndpointKey("qwant")] = stalled.URL
+	search, cancel := &pkg.SearchCommand{}, &pkg.CancelCommand{}
+	initCommand(t, search, executor)
+	initCommand(t, cancel, executor)
+	alice := servicetest.NewUser("alice")
+	searched := make(chan []*domain.ClientMessage)
+	go func() {
+		messages, _ := search.Execute(servicetest.NewCommandMessage(alice, "search", "golang", false))
+		searched <- messages
+	}()
+	<-arrived
+	assertTexts(t, run(t, cancel, servicetest.NewUser("bob"), "", false), "Nothing to cancel")
+	assertTexts(t, run(t, cancel, alice, "", false), "Cancelled 1 running command(s)")
+	assertTexts(t, servicetest.Texts(<-searched), "Cancelled")
+}
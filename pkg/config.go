@@ -0,0 +1,354 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/raf924/connector-sdk/command"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// configFileKey is the ApiKeys entry naming the JSON file holding the Config of the commands
+const configFileKey = "config_file"
+
+// ConfigEnvPrefix prefixes the environment variables overriding the settings of the configuration file.
+// Each variable is named after the path of its setting, e.g. BOT_SERVICES_SEARCH_RESULTS for search.results.
+const ConfigEnvPrefix = "BOT_SERVICES_"
+
+// Config holds the settings of the commands
+type Config struct {
+	// ApiKeys override the ApiKeys entries of the executor, e.g. "openweather" or "youtube"
+	ApiKeys map[string]string `json:"api_keys,omitempty"`
+	// Endpoints override the base URLs of the upstreams, keyed by upstream
+	Endpoints map[string]string `json:"endpoints,omitempty"`
+	// Channels are the channel policies, the ones given by the executor unless set
+	Channels   map[string]ChannelPolicy `json:"channels,omitempty"`
+	RateLimits RateLimitsConfig         `json:"rate_limits"`
+	Search     SearchConfig             `json:"search"`
+	Dictionary DictionaryConfig         `json:"dictionary"`
+	Weather    WeatherConfig            `json:"weather"`
+	Wiki       WikiConfig               `json:"wiki"`
+	Urban      UrbanConfig              `json:"urban"`
+	Joke       JokeConfig               `json:"joke"`
+	Replies    RepliesConfig            `json:"replies"`
+	Cache      CacheConfig              `json:"cache"`
+}
+
+type RateLimitsConfig struct {
+	// User is the limit of each user
+	User RateLimit `json:"user"`
+	// Channel is the limit of each channel
+	Channel RateLimit `json:"channel"`
+	// Upstream is the limit of the upstreams missing from Upstreams
+	Upstream RateLimit `json:"upstream"`
+	// Upstreams are the limits of the upstreams that have a quota, keyed by upstream
+	Upstreams map[string]RateLimit `json:"upstreams"`
+}
+
+type SearchConfig struct {
+	// Results is the number of results per page
+	Results int `json:"results"`
+	// SafeSearch filters adult results: 0 does not, 1 moderately and 2 strictly
+	SafeSearch int `json:"safesearch"`
+	// Locale is the locale of results, e.g. "en_US"
+	Locale string `json:"locale"`
+}
+
+type DictionaryConfig struct {
+	// Lang is the language of the definitions
+	Lang string `json:"lang"`
+}
+
+type WeatherConfig struct {
+	// Units are either metric or imperial
+	Units string `json:"units"`
+	// Providers are the upstreams forecasts are asked to in turn until one gives one, among openweather and openmeteo
+	Providers []string `json:"providers"`
+	// AlertMinutes is how often the locations channels subscribed to are checked for severe weather
+	AlertMinutes int `json:"alert_minutes"`
+}
+
+type WikiConfig struct {
+	// Lang is the language of the articles, the one of the endpoint if empty
+	Lang string `json:"lang"`
+}
+
+type UrbanConfig struct {
+	// MaxLength is the length in bytes above which definitions are cut
+	MaxLength int `json:"max_length"`
+}
+
+type JokeConfig struct {
+	// Sources are the upstreams jokes are picked from, among reddit and dadjoke
+	Sources []string `json:"sources"`
+}
+
+type RepliesConfig struct {
+	// MaxLength is the length in bytes above which a reply is split in several messages
+	MaxLength int `json:"max_length"`
+	// MaxMessages is the number of messages a reply can be split into before being cut
+	MaxMessages int `json:"max_messages"`
+}
+
+type CacheConfig struct {
+	// File is the file the cache is persisted to so that it survives restarts, the cache being kept in memory if empty
+	File string `json:"file"`
+}
+
+// DefaultConfig returns the settings the commands have unless configured otherwise
+func DefaultConfig() Config {
+	upstreamLimits := make(map[string]RateLimit, len(defaultUpstreamLimits))
+	for upstream, limit := range defaultUpstreamLimits {
+		upstreamLimits[upstream] = limit
+	}
+	return Config{
+		RateLimits: RateLimitsConfig{
+			User:      defaultUserLimit,
+			Channel:   defaultChannelLimit,
+			Upstream:  defaultUpstreamLimit,
+			Upstreams: upstreamLimits,
+		},
+		Search:     SearchConfig{Results: searchPageSize, SafeSearch: 1, Locale: defaultSearchLocale},
+		Dictionary: DictionaryConfig{Lang: "en"},
+		Weather:    WeatherConfig{Units: "metric", Providers: []string{openWeatherUpstream, openMeteoUpstream}, AlertMinutes: defaultAlertMinutes},
+		Urban:      UrbanConfig{MaxLength: urbanMaxLength},
+		Joke:       JokeConfig{Sources: []string{dadJokeUpstream, redditUpstream}},
+		Replies:    RepliesConfig{MaxLength: defaultMaxMessageLength, MaxMessages: defaultMaxMessages},
+	}
+}
+
+// Validate tells what is wrong with the settings, if anything
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	for upstream, rawUrl := range c.Endpoints {
+		if _, ok := defaultEndpoints[upstream]; !ok {
+			problems = append(problems, fmt.Sprintf("endpoints: unknown upstream %q", upstream))
+		} else if _, err := parseEndpoint(upstream, rawUrl); err != nil {
+			problems = append(problems, "endpoints: "+err.Error())
+		}
+	}
+	for name, rawUrl := range c.ApiKeys {
+		if !strings.HasSuffix(name, endpointKeySuffix) {
+			continue
+		}
+		upstream := strings.TrimSuffix(name, endpointKeySuffix)
+		if _, ok := defaultEndpoints[upstream]; !ok {
+			problems = append(problems, fmt.Sprintf("api_keys: unknown upstream %q in %s", upstream, name))
+		} else if _, err := parseEndpoint(upstream, rawUrl); err != nil {
+			problems = append(problems, "api_keys: "+err.Error())
+		}
+	}
+	limits := map[string]RateLimit{"user": c.RateLimits.User, "channel": c.RateLimits.Channel, "upstream": c.RateLimits.Upstream}
+	for upstream, limit := range c.RateLimits.Upstreams {
+		limits["upstreams."+upstream] = limit
+	}
+	for name, limit := range limits {
+		check(limit.PerMinute > 0 && limit.Burst >= 1, "rate_limits.%s must allow a burst of at least 1 and a positive rate per minute", name)
+	}
+	check(c.Search.Results >= 1 && c.Search.Results <= 10, "search.results must be between 1 and 10")
+	check(c.Search.SafeSearch >= 0 && c.Search.SafeSearch <= 2, "search.safesearch must be 0, 1 or 2")
+	check(languagePattern.MatchString(c.Search.Locale), "search.locale %q is not a locale", c.Search.Locale)
+	check(len(dictionaryLanguage(c.Dictionary.Lang, "")) > 0,
+		"dictionary.lang must be one of %s", strings.Join(dictionaryLanguages, ", "))
+	check(c.Weather.Units == "metric" || c.Weather.Units == "imperial", "weather.units must be metric or imperial")
+	check(len(c.Weather.Providers) > 0, "weather.providers cannot be empty")
+	for _, provider := range c.Weather.Providers {
+		check(provider == openWeatherUpstream || provider == openMeteoUpstream,
+			"weather.providers must be among %s and %s, not %q", openWeatherUpstream, openMeteoUpstream, provider)
+	}
+	check(c.Weather.AlertMinutes >= 1, "weather.alert_minutes must be at least 1")
+	check(len(c.Wiki.Lang) == 0 || languagePattern.MatchString(c.Wiki.Lang), "wiki.lang %q is not a language", c.Wiki.Lang)
+	check(c.Urban.MaxLength > 0, "urban.max_length must be positive")
+	check(len(c.Joke.Sources) > 0, "joke.sources cannot be empty")
+	for _, source := range c.Joke.Sources {
+		check(source == dadJokeUpstream || source == redditUpstream,
+			"joke.sources must be among %s and %s, not %q", dadJokeUpstream, redditUpstream, source)
+	}
+	check(c.Replies.MaxLength > len(moreHint), "replies.max_length must be greater than %d", len(moreHint))
+	check(c.Replies.MaxMessages > 0, "replies.max_messages must be positive")
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// LoadConfig returns DefaultConfig overridden by the JSON file filename, if not empty, which cannot hold unknown settings,
+// then by the environment variables prefixed with ConfigEnvPrefix
+func LoadConfig(filename string) (Config, error) {
+	config := DefaultConfig()
+	if len(filename) > 0 {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return Config{}, fmt.Errorf("cannot read configuration: %w", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		// a misspelled setting would otherwise be silently left to its default
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			return Config{}, fmt.Errorf("invalid configuration file %s: %w", filename, err)
+		}
+	}
+	if err := overrideFromEnv(reflect.ValueOf(&config).Elem(), ConfigEnvPrefix); err != nil {
+		return Config{}, err
+	}
+	return config, config.Validate()
+}
+
+// overrideFromEnv sets the fields of v whose environment variable is set, lists being comma-separated.
+// Maps are only read from the file.
+func overrideFromEnv(v reflect.Value, prefix string) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name := prefix + strings.ToUpper(strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0])
+		if field.Kind() == reflect.Struct {
+			if err := overrideFromEnv(field, name+"_"); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s must be a number: %w", name, err)
+			}
+			field.SetFloat(f)
+		case reflect.Int:
+			i, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s must be a number: %w", name, err)
+			}
+			field.SetInt(int64(i))
+		case reflect.Slice:
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); len(item) > 0 {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		}
+	}
+	return nil
+}
+
+var (
+	// configLock guards currentConfig and configuredCommands, and serializes the changes of configuration
+	configLock         sync.RWMutex
+	currentConfig      = DefaultConfig()
+	configuredCommands []configuredCommand
+)
+
+// configurable is implemented by the commands whose settings come from the Config.
+// Such a command keeps a pointer to its settings in an atomic.Value, named current, which configure's func replaces
+// as a whole: each invocation loads the settings once, so that it runs with a consistent set of them until it ends.
+type configurable interface {
+	// configure builds the settings of the command from config, returning the func that replaces them at once,
+	// invocations in progress keeping the previous ones
+	configure(config commandConfig) (func(), error)
+}
+
+type configuredCommand struct {
+	command      configurable
+	executorKeys map[string]string
+}
+
+// SetConfig validates config and applies it to the commands, the initialized ones included.
+// Nothing is changed unless every command accepts config, and invocations in progress finish with the settings they started with.
+func SetConfig(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	var cache Cache
+	if config.Cache.File != currentConfig.Cache.File {
+		var err error
+		if cache, err = configuredCache(config.Cache.File); err != nil {
+			return fmt.Errorf("cannot open cache: %w", err)
+		}
+	}
+	applies := make([]func(), 0, len(configuredCommands))
+	for _, configured := range configuredCommands {
+		apply, err := configured.command.configure(commandConfig{Config: config, executorKeys: configured.executorKeys})
+		if err != nil {
+			return err
+		}
+		applies = append(applies, apply)
+	}
+	currentConfig = config
+	SetReplyLimits(config.Replies.MaxLength, config.Replies.MaxMessages)
+	setRateLimits(config.RateLimits)
+	SetChannelPolicies(config.Channels)
+	if cache != nil {
+		SetCache(cache)
+	}
+	for _, apply := range applies {
+		apply()
+	}
+	return nil
+}
+
+// configureCommand applies the current Config to c, along with the ApiKeys of executor,
+// and keeps c up to date with the Config set from then on
+func configureCommand(c configurable, executor command.Executor) error {
+	keys := executor.ApiKeys()
+	configLock.Lock()
+	defer configLock.Unlock()
+	apply, err := c.configure(commandConfig{Config: currentConfig, executorKeys: keys})
+	if err != nil {
+		return err
+	}
+	apply()
+	for i, configured := range configuredCommands {
+		if configured.command == c {
+			configuredCommands[i].executorKeys = keys
+			return nil
+		}
+	}
+	configuredCommands = append(configuredCommands, configuredCommand{command: c, executorKeys: keys})
+	return nil
+}
+
+// commandConfig is the Config as seen by a command, along with the ApiKeys of the executor it was initialized with
+type commandConfig struct {
+	Config
+	executorKeys map[string]string
+}
+
+// apiKey returns the API key named name, from the Config or else from the executor
+func (c commandConfig) apiKey(name string) string {
+	if key, ok := c.ApiKeys[name]; ok {
+		return key
+	}
+	return c.executorKeys[name]
+}
+
+// endpoint returns the base URL of upstream, as configured or its default one
+func (c commandConfig) endpoint(upstream string) (*url.URL, error) {
+	rawUrl, ok := c.Endpoints[upstream]
+	if !ok {
+		rawUrl = c.apiKey(EndpointKey(upstream))
+	}
+	if len(rawUrl) == 0 {
+		rawUrl = defaultEndpoints[upstream]
+	}
+	return parseEndpoint(upstream, rawUrl)
+}
@@ -0,0 +1,64 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes content to a configuration file removed at the end of the test and returns its name
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return filename
+}
+
+func TestLoadConfig(t *testing.T) {
+	filename := writeConfig(t, `{"search": {"results": 3, "locale": "fr_FR"}, "joke": {"sources": ["reddit"]}}`)
+	t.Setenv(pkg.ConfigEnvPrefix+"SEARCH_RESULTS", "7")
+	t.Setenv(pkg.ConfigEnvPrefix+"WEATHER_PROVIDERS", "openmeteo, openweather")
+	config, err := pkg.LoadConfig(filename)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	want := pkg.DefaultConfig()
+	want.Search.Results = 7
+	want.Search.Locale = "fr_FR"
+	want.Joke.Sources = []string{"reddit"}
+	want.Weather.Providers = []string{"openmeteo", "openweather"}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("LoadConfig() = %+v, want %+v", config, want)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := map[string]string{
+		`{"search": {"safe_search": 2}}`:                                `unknown field "safe_search"`,
+		`{"search": {"results": 20}}`:                                   "search.results must be between 1 and 10",
+		`{"weather": {"units": "kelvin"}}`:                              "weather.units must be metric or imperial",
+		`{"endpoints": {"qwant": "ftp://example.com"}}`:                 "is not an http(s) URL",
+		`{"rate_limits": {"user": {"per_minute": 0, "burst": 1}}}`:      "rate_limits.user must allow a burst of at least 1 and a positive rate per minute",
+		`{"rate_limits": {"upstreams": {"qwant": {"per_minute": 10}}}}`: "rate_limits.upstreams.qwant must allow a burst of at least 1",
+	}
+	for content, want := range tests {
+		if _, err := pkg.LoadConfig(writeConfig(t, content)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadConfig(%s) error = %v, want %s", content, err, want)
+		}
+	}
+	t.Setenv(pkg.ConfigEnvPrefix+"SEARCH_RESULTS", "many")
+	if _, err := pkg.LoadConfig(""); err == nil || !strings.Contains(err.Error(), "BOT_SERVICES_SEARCH_RESULTS must be a number") {
+		t.Errorf("LoadConfig() error = %v, want the variable to be a number", err)
+	}
+}
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if err := pkg.DefaultConfig().Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
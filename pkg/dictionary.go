@@ -1,20 +1,43 @@
 package pkg
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
-	"io/ioutil"
-	"log"
-	"net/http"
 	"net/url"
-	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 var _ command.Command = (*DictionaryCommand)(nil)
+var _ Helper = (*DictionaryCommand)(nil)
+var _ ContextExecutable = (*DictionaryCommand)(nil)
+
+const (
+	dictionaryTimeout  = 5 * time.Second
+	dictionaryCacheTTL = 7 * 24 * time.Hour
+	// meanings per page
+	dictionaryPageSize = 2
+)
+
+var dictionaryOptions = []commandOption{
+	{name: "lang", short: "l", choices: dictionaryLanguages},
+}
+
+var dictionaryLanguages = []string{"en", "es", "fr", "de", "it", "pt-BR", "ru", "ja", "ko", "hi", "ar", "tr"}
+
+// dictionaryLanguage returns the supported language matching lang, fallback if there is none
+func dictionaryLanguage(lang string, fallback string) string {
+	for _, language := range dictionaryLanguages {
+		if strings.EqualFold(language, strings.Replace(lang, "_", "-", 1)) {
+			return language
+		}
+	}
+	return fallback
+}
 
 type DictionaryResponse []struct {
 	Word      string `json:"word"`
@@ -31,18 +54,46 @@ type DictionaryResponse []struct {
 	} `json:"meanings"`
 }
 
+// dictionarySettings are the settings of DictionaryCommand coming from the Config
+type dictionarySettings struct {
+	dictionaryUrl *url.URL
+	// lang is the default language of the definitions
+	lang string
+}
+
 type DictionaryCommand struct {
 	command.NoOpInterceptor
-	dictionaryUrl *url.URL
+	current  atomic.Value
+	client   *httpClient
+	renderer Renderer
+	trigger  string
 }
 
-func (d *DictionaryCommand) Init(command.Executor) error {
-	dU, err := url.Parse("https://api.dictionaryapi.dev")
+func (d *DictionaryCommand) Init(executor command.Executor) error {
+	if err := setUp(executor); err != nil {
+		return err
+	}
+	var err error
+	d.client = newHttpClient(dictionaryTimeout, defaultMaxBodySize)
+	d.trigger = executor.Trigger()
+	d.renderer, err = rendererFor(executor)
 	if err != nil {
 		return err
 	}
-	d.dictionaryUrl = dU
-	return nil
+	return configureCommand(d, executor)
+}
+
+func (d *DictionaryCommand) configure(config commandConfig) (func(), error) {
+	dU, err := config.endpoint(dictionaryUpstream)
+	if err != nil {
+		return nil, err
+	}
+	settings := &dictionarySettings{dictionaryUrl: dU, lang: config.Dictionary.Lang}
+	return func() { d.current.Store(settings) }, nil
+}
+
+func (d *DictionaryCommand) settings() *dictionarySettings {
+	return d.current.Load().(*dictionarySettings)
 }
 
 func (d *DictionaryCommand) Name() string {
@@ -53,36 +104,78 @@ func (d *DictionaryCommand) Aliases() []string {
 	return []string{"d", "define", "dict"}
 }
 
+func (d *DictionaryCommand) Usage() string {
+	return "<word> " + optionsUsage(dictionaryOptions)
+}
+
+func (d *DictionaryCommand) Description() string {
+	return "Defines a word, in the language given by --lang or else " + d.settings().lang
+}
+
+func (d *DictionaryCommand) Examples() []string {
+	return []string{"serendipity", "--lang=fr bonjour"}
+}
+
+func (d *DictionaryCommand) upstreams() []string {
+	return []string{dictionaryUpstream}
+}
+
 func (d *DictionaryCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
-	dU := *d.dictionaryUrl
-	dU.Path = path.Join("api", "v2", "entries", "en", url.PathEscape(strings.Join(command.Args(), " ")))
-	client := http.Client{Timeout: time.Second * 5}
-	log.Println(dU.String())
-	resp, err := client.Get(dU.String())
+	return execute(d, command)
+}
+
+func (d *DictionaryCommand) ExecuteContext(ctx context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	args, err := parseArgs(command.ArgString(), dictionaryOptions...)
 	if err != nil {
 		return nil, err
 	}
-	meaningText := ""
+	word := args.text()
+	if len(word) == 0 {
+		return nil, badInput("Which word should I define?")
+	}
+	settings := d.settings()
+	lang := args.string("lang", dictionaryLanguage(preferencesOf(command.Sender()).Lang, settings.lang))
+	dU := endpointUrl(settings.dictionaryUrl, "api", "v2", "entries", lang)
+	// the word is a single segment even if it holds a slash, hence set escaped rather than joined to the path
+	dU.RawPath = dU.EscapedPath() + "/" + url.PathEscape(word)
+	dU.Path += "/" + word
 	var dictionaryResponse DictionaryResponse
-	b, err := ioutil.ReadAll(resp.Body)
+	err = cached(cacheKey(dictionaryUpstream, lang, word), dictionaryCacheTTL, &dictionaryResponse, func() error {
+		b, err := d.client.get(ctx, dU.String(), nil)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(b, &dictionaryResponse)
+	})
 	if err != nil {
-		return nil, err
+		return nil, explain(upstreamError(dictionaryUpstream, err), NotFound, "No definition found for %q", word)
 	}
-	log.Println(string(b))
-	err = json.Unmarshal(b, &dictionaryResponse)
-	if err != nil {
-		return nil, err
+	if len(dictionaryResponse) == 0 {
+		return nil, notFound("No definition found for %q", word)
+	}
+	header := Reply{Text(fmt.Sprintf("%s:", dictionaryResponse[0].Word))}
+	if len(dictionaryResponse[0].Phonetics) > 0 {
+		header = append(header, Link{Text: dictionaryResponse[0].Phonetics[0].Text, Url: dictionaryResponse[0].Phonetics[0].Audio})
 	}
-	for _, meaning := range dictionaryResponse[0].Meanings {
-		definitionText := ""
-		for _, definition := range meaning.Definitions {
-			definitionText += fmt.Sprintf(">- %s (ex: %s)\n", definition.Definition, definition.Example)
+	var meanings []Reply
+	for _, entry := range dictionaryResponse {
+		for _, meaning := range entry.Meanings {
+			var definitions List
+			for _, definition := range meaning.Definitions {
+				definitions = append(definitions, fmt.Sprintf("%s (ex: %s)", definition.Definition, definition.Example))
+			}
+			meanings = append(meanings, Reply{Heading(meaning.SpeechPart), definitions})
 		}
-		meaningText += fmt.Sprintf(">### %s\n%s", meaning.SpeechPart, definitionText)
 	}
-
-	reply := fmt.Sprintf("%s:\n[%s](%s)\n%s", dictionaryResponse[0].Word, dictionaryResponse[0].Phonetics[0].Text, dictionaryResponse[0].Phonetics[0].Audio, meaningText)
+	pages := chunk(meanings, dictionaryPageSize)
+	first := header
+	var others []page
+	if len(pages) > 0 {
+		first = append(first, pages[0]...)
+		others = staticPages(pages[1:])
+	}
+	reply := paginate(command, d.trigger, first, others)
 	return []*domain.ClientMessage{
-		domain.NewClientMessage(reply, command.Sender(), command.Private()),
+		domain.NewClientMessage(reply.Render(d.renderer), command.Sender(), command.Private()),
 	}, nil
 }
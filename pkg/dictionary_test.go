@@ -0,0 +1,44 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"testing"
+)
+
+func TestDictionaryCommand(t *testing.T) {
+	server, executor := newServer(t)
+	dictionary := &pkg.DictionaryCommand{}
+	initCommand(t, dictionary, executor)
+	assertTexts(t, run(t, dictionary, servicetest.NewUser("alice"), "hello", false),
+		"hello:\n"+
+			"/həˈləʊ/ (https://api.dictionaryapi.dev/media/pronunciations/en/hello-uk.mp3)\n"+
+			"noun:\n"+
+			"- \"Hello!\" or an equivalent greeting. (ex: She gave a cheery hello.)\n"+
+			"verb:\n"+
+			"- To greet with \"hello\". (ex: He helloed me from across the street.)\n"+
+			"(1 more, use !more)")
+	requests := server.Requests("dictionary")
+	if len(requests) != 1 || requests[0].Path != "/api/v2/entries/en/hello" {
+		t.Errorf("dictionary requests = %v, want /api/v2/entries/en/hello", requests)
+	}
+}
+
+func TestDictionaryCommandNotFound(t *testing.T) {
+	server, executor := newServer(t)
+	server.Handle(servicetest.EmptyFixtures()...)
+	dictionary := &pkg.DictionaryCommand{}
+	initCommand(t, dictionary, executor)
+	assertTexts(t, run(t, dictionary, servicetest.NewUser("alice"), "zzzz", false), "No definition found for \"zzzz\"")
+}
+
+func TestDictionaryCommandEscapesWord(t *testing.T) {
+	server, executor := newServer(t)
+	dictionary := &pkg.DictionaryCommand{}
+	initCommand(t, dictionary, executor)
+	run(t, dictionary, servicetest.NewUser("alice"), "--lang fr \"crème brûlée\"", false)
+	requests := server.Requests("dictionary")
+	if want := "/api/v2/entries/fr/cr%C3%A8me%20br%C3%BBl%C3%A9e"; len(requests) != 1 || requests[0].EscapedPath() != want {
+		t.Errorf("dictionary requests = %v, want %s", requests, want)
+	}
+}
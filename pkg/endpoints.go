@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+)
+
+// Names of the upstreams reached by the commands in pkg.
+// The base URL of each of them can be overridden with an ApiKeys entry named after the upstream followed by "_url"
+// (e.g. "qwant_url"), or with the Endpoints of the Config, so that commands can run against local stand-ins
+// or self-hosted mirrors.
+const (
+	qwantUpstream       = "qwant"
+	dictionaryUpstream  = "dictionary"
+	geocodingUpstream   = "geocoding"
+	timeApiUpstream     = "timeapi"
+	openWeatherUpstream = "openweather"
+	openMeteoUpstream   = "openmeteo"
+	wikipediaUpstream   = "wikipedia"
+	urbanUpstream       = "urban"
+	redditUpstream      = "reddit"
+	dadJokeUpstream     = "dadjoke"
+	youtubeUpstream     = "youtube"
+	youtubeApiUpstream  = "youtubeapi"
+)
+
+const endpointKeySuffix = "_url"
+
+var defaultEndpoints = map[string]string{
+	qwantUpstream:       "https://api.qwant.com",
+	dictionaryUpstream:  "https://api.dictionaryapi.dev",
+	geocodingUpstream:   "https://geocode.maps.co",
+	timeApiUpstream:     "https://www.timeapi.io",
+	openWeatherUpstream: "https://api.openweathermap.org",
+	openMeteoUpstream:   "https://api.open-meteo.com",
+	wikipediaUpstream:   "https://en.wikipedia.org",
+	urbanUpstream:       "http://api.urbandictionary.com",
+	redditUpstream:      "https://www.reddit.com",
+	dadJokeUpstream:     "https://icanhazdadjoke.com",
+	youtubeUpstream:     "https://www.youtube.com",
+	youtubeApiUpstream:  "https://youtube.googleapis.com",
+}
+
+// Upstreams returns the names of the upstreams reached by the commands, sorted
+func Upstreams() []string {
+	upstreams := make([]string, 0, len(defaultEndpoints))
+	for upstream := range defaultEndpoints {
+		upstreams = append(upstreams, upstream)
+	}
+	sort.Strings(upstreams)
+	return upstreams
+}
+
+// EndpointKey returns the ApiKeys entry overriding the base URL of upstream
+func EndpointKey(upstream string) string {
+	return upstream + endpointKeySuffix
+}
+
+func parseEndpoint(upstream string, rawUrl string) (*url.URL, error) {
+	endpointUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s endpoint: %w", upstream, err)
+	}
+	if !endpointUrl.IsAbs() || len(endpointUrl.Host) == 0 {
+		return nil, fmt.Errorf("invalid %s endpoint: %s is not an absolute URL", upstream, rawUrl)
+	}
+	if endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https" {
+		return nil, fmt.Errorf("invalid %s endpoint: %s is not an http(s) URL", upstream, rawUrl)
+	}
+	return endpointUrl, nil
+}
+
+// endpointUrl returns a copy of base with elements appended to its path, keeping any path prefix of mirrors
+func endpointUrl(base *url.URL, elements ...string) *url.URL {
+	u := *base
+	u.Path = path.Join(append([]string{"/", base.Path}, elements...)...)
+	u.RawPath = ""
+	return &u
+}
@@ -0,0 +1,30 @@
+package pkg
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	for _, rawUrl := range []string{"http://localhost:8080", "https://mirror.example.com/qwant"} {
+		if _, err := parseEndpoint(qwantUpstream, rawUrl); err != nil {
+			t.Errorf("parseEndpoint(%q) error = %v", rawUrl, err)
+		}
+	}
+	for _, rawUrl := range []string{"localhost:8080", "/qwant", "ftp://mirror.example.com", "http://%41"} {
+		if _, err := parseEndpoint(qwantUpstream, rawUrl); err == nil {
+			t.Errorf("parseEndpoint(%q) error = nil, want an invalid endpoint", rawUrl)
+		}
+	}
+}
+
+func TestEndpointUrl(t *testing.T) {
+	base, _ := url.Parse("https://mirror.example.com/dictionary/")
+	got := endpointUrl(base, "api/v2/entries", "en", "b c")
+	if want := "https://mirror.example.com/dictionary/api/v2/entries/en/b%20c"; got.String() != want {
+		t.Errorf("endpointUrl() = %s, want %s", got, want)
+	}
+	if base.Path != "/dictionary/" {
+		t.Errorf("base path = %s, want it left unchanged", base.Path)
+	}
+}
@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/raf924/connector-sdk/domain"
+	"net/http"
+)
+
+// ErrorKind tells what went wrong during an invocation, whatever the command
+type ErrorKind string
+
+const (
+	NotFound            ErrorKind = "not found"
+	UpstreamUnavailable ErrorKind = "upstream unavailable"
+	BadInput            ErrorKind = "bad input"
+	MissingApiKey       ErrorKind = "missing api key"
+	QuotaExceeded       ErrorKind = "quota exceeded"
+)
+
+// Error is returned by the commands when they cannot answer.
+// Its Reason is meant for users while Err details the failure for operators.
+type Error struct {
+	Kind     ErrorKind
+	Reason   string
+	Upstream string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	message := string(e.Kind)
+	if len(e.Upstream) > 0 {
+		message = e.Upstream + ": " + message
+	}
+	if len(e.Reason) > 0 {
+		message += ": " + e.Reason
+	}
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage is what users are told about the error
+func (e *Error) UserMessage() string {
+	if len(e.Reason) > 0 {
+		return e.Reason
+	}
+	switch e.Kind {
+	case NotFound:
+		return "Nothing was found"
+	case UpstreamUnavailable:
+		return fmt.Sprintf("%s is unavailable right now, please try again later", e.Upstream)
+	case MissingApiKey:
+		return fmt.Sprintf("This command is not configured: the %s API key is missing or invalid", e.Upstream)
+	case QuotaExceeded:
+		return fmt.Sprintf("The %s quota is exceeded, please try again later", e.Upstream)
+	}
+	return "Something went wrong"
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &Error{Kind: NotFound, Reason: fmt.Sprintf(format, args...)}
+}
+
+func badInput(format string, args ...interface{}) error {
+	return &Error{Kind: BadInput, Reason: fmt.Sprintf(format, args...)}
+}
+
+func missingApiKey(upstream string) error {
+	return &Error{Kind: MissingApiKey, Upstream: upstream}
+}
+
+// upstreamError classifies err, returned when calling upstream
+func upstreamError(upstream string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var typed *Error
+	if errors.As(err, &typed) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	kind := UpstreamUnavailable
+	var status *statusError
+	if errors.As(err, &status) {
+		switch status.StatusCode {
+		case http.StatusNotFound:
+			kind = NotFound
+		case http.StatusTooManyRequests:
+			kind = QuotaExceeded
+		case http.StatusUnauthorized, http.StatusForbidden:
+			kind = MissingApiKey
+		}
+	}
+	return &Error{Kind: kind, Upstream: upstream, Err: err}
+}
+
+// explain gives a reason to err, if it is an Error of the given kind
+func explain(err error, kind ErrorKind, format string, args ...interface{}) error {
+	var typed *Error
+	if errors.As(err, &typed) && typed.Kind == kind {
+		typed.Reason = fmt.Sprintf(format, args...)
+	}
+	return err
+}
+
+// friendlyErrors replies to users with what went wrong instead of returning raw errors,
+// whose details are logged for operators
+func friendlyErrors(next handler) handler {
+	return func(inv *invocation) ([]*domain.ClientMessage, error) {
+		messages, err := next(inv)
+		if err == nil {
+			return messages, nil
+		}
+		if inv.passive {
+			// nobody asked for anything
+			return nil, nil
+		}
+		var typed *Error
+		reply := "Something went wrong"
+		switch {
+		case errors.As(err, &typed):
+			reply = typed.UserMessage()
+		case errors.Is(err, context.Canceled):
+			reply = "Cancelled"
+		case errors.Is(err, context.DeadlineExceeded):
+			reply = "This took too long, please try again later"
+		}
+		return []*domain.ClientMessage{
+			domain.NewClientMessage(reply, inv.sender, inv.private),
+		}, nil
+	}
+}
@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestUpstreamError(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind ErrorKind
+	}{
+		{&statusError{StatusCode: http.StatusNotFound}, NotFound},
+		{&statusError{StatusCode: http.StatusTooManyRequests}, QuotaExceeded},
+		{&statusError{StatusCode: http.StatusUnauthorized}, MissingApiKey},
+		{&statusError{StatusCode: http.StatusForbidden}, MissingApiKey},
+		{&statusError{StatusCode: http.StatusBadGateway}, UpstreamUnavailable},
+		{fmt.Errorf("wrapped: %w", &statusError{StatusCode: http.StatusNotFound}), NotFound},
+		{errors.New("connection refused"), UpstreamUnavailable},
+	}
+	for _, test := range tests {
+		var typed *Error
+		if err := upstreamError(qwantUpstream, test.err); !errors.As(err, &typed) || typed.Kind != test.kind || typed.Upstream != qwantUpstream {
+			t.Errorf("upstreamError(%v) = %v, want a qwant %s error", test.err, err, test.kind)
+		}
+	}
+	for _, err := range []error{nil, context.Canceled, badInput("what?")} {
+		if got := upstreamError(qwantUpstream, err); got != err {
+			t.Errorf("upstreamError(%v) = %v, want it unchanged", err, got)
+		}
+	}
+}
+
+func TestErrorUserMessage(t *testing.T) {
+	tests := []struct {
+		err  *Error
+		want string
+	}{
+		{&Error{Kind: UpstreamUnavailable, Upstream: "qwant"}, "qwant is unavailable right now, please try again later"},
+		{&Error{Kind: MissingApiKey, Upstream: "openweather"}, "This command is not configured: the openweather API key is missing or invalid"},
+		{&Error{Kind: QuotaExceeded, Upstream: "youtubeapi"}, "The youtubeapi quota is exceeded, please try again later"},
+		{&Error{Kind: NotFound, Upstream: "urban"}, "Nothing was found"},
+		{&Error{Kind: NotFound, Reason: "No definition found", Err: errors.New("404")}, "No definition found"},
+	}
+	for _, test := range tests {
+		if got := test.err.UserMessage(); got != test.want {
+			t.Errorf("UserMessage() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	err := explain(upstreamError("urban", &statusError{StatusCode: http.StatusNotFound}), NotFound, "No definition found for %q", "yeet")
+	if got := err.(*Error).UserMessage(); got != "No definition found for \"yeet\"" {
+		t.Errorf("UserMessage() = %q, want the reason explained", got)
+	}
+	err = explain(upstreamError("urban", errors.New("timeout")), NotFound, "No definition found")
+	if got := err.(*Error).UserMessage(); got != "urban is unavailable right now, please try again later" {
+		t.Errorf("UserMessage() = %q, want errors of other kinds left unexplained", got)
+	}
+}
@@ -0,0 +1,108 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Forecast is the weather at a location, temperatures being in Celsius
+type Forecast struct {
+	Current Conditions
+	// Hours are the forecasts of the coming hours, in as many hours apart as the provider allows
+	Hours []HourForecast
+	// Days are the coming days, today excluded
+	Days []DayForecast
+	// Sunrise and Sunset are today's, zero when the provider does not tell them
+	Sunrise time.Time
+	Sunset  time.Time
+}
+
+// Conditions are the weather at a given time
+type Conditions struct {
+	Temperature float64
+	Sky         string
+	FeelsLike   float64
+	// Humidity and Clouds are percentages
+	Humidity float64
+	Clouds   float64
+	// Pressure is at sea level, in hPa
+	Pressure float64
+	// WindSpeed and WindGust are in m/s
+	WindSpeed float64
+	WindGust  float64
+	// WindDirection is where the wind comes from, in degrees clockwise from the north
+	WindDirection float64
+	// Visibility is in meters
+	Visibility float64
+}
+
+// HourForecast is the weather expected at a given time
+type HourForecast struct {
+	// Time is in the time zone of the location
+	Time        time.Time
+	Temperature float64
+	// PrecipitationProbability is between 0 and 1
+	PrecipitationProbability float64
+	Sky                      string
+}
+
+// DayForecast is the weather expected on a day
+type DayForecast struct {
+	// Date is midnight of the day, in the time zone of the location
+	Date time.Time
+	Min  float64
+	Max  float64
+	// Sky describes the sky over the day, e.g. "light rain - overcast clouds"
+	Sky string
+}
+
+// WeatherProvider fetches forecasts from an upstream
+type WeatherProvider interface {
+	// Name is the one of the upstream, as used in the Config
+	Name() string
+	// Forecast returns the weather at latitude and longitude, now being the local time there
+	Forecast(ctx context.Context, latitude float64, longitude float64, now time.Time) (*Forecast, error)
+}
+
+// weatherProviders returns the providers named in names, in the same order
+func weatherProviders(names []string, client *httpClient, config commandConfig) ([]WeatherProvider, error) {
+	providers := make([]WeatherProvider, 0, len(names))
+	for _, name := range names {
+		endpoint, err := config.endpoint(name)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case openWeatherUpstream:
+			providers = append(providers, &openWeatherProvider{client: client, baseUrl: endpoint, apiKey: config.apiKey("openweather")})
+		case openMeteoUpstream:
+			providers = append(providers, &openMeteoProvider{client: client, baseUrl: endpoint})
+		}
+	}
+	return providers, nil
+}
+
+// forecastWithFallback returns the forecast of the first of the providers able to give one.
+// If none is, the error of the first one that was not missing its API key is returned.
+func forecastWithFallback(ctx context.Context, providers []WeatherProvider, latitude float64, longitude float64, now time.Time) (*Forecast, error) {
+	var firstErr error
+	for _, provider := range providers {
+		forecast, err := provider.Forecast(ctx, latitude, longitude, now)
+		if err == nil {
+			return forecast, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		var typed *Error
+		if firstErr == nil || (errors.As(firstErr, &typed) && typed.Kind == MissingApiKey) {
+			firstErr = err
+		}
+		loggerFrom(ctx).Warn("weather provider failed, trying the next one", "provider", provider.Name(), "err", err)
+	}
+	if firstErr == nil {
+		return nil, errors.New("no weather provider configured")
+	}
+	return nil, firstErr
+}
@@ -0,0 +1,347 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/raf924/connector-sdk/command"
+	"github.com/raf924/connector-sdk/domain"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ command.Command = (*StatusCommand)(nil)
+var _ Helper = (*StatusCommand)(nil)
+var _ ContextExecutable = (*StatusCommand)(nil)
+
+const (
+	healthProbeTimeout = 5 * time.Second
+	// probes are reused for a while so that checking the health cannot be used to flood the upstreams
+	healthProbeTTL = 30 * time.Second
+)
+
+// UpstreamHealth tells how an upstream answers a probe and how the calls of the commands to it went
+type UpstreamHealth struct {
+	Upstream string `json:"upstream"`
+	Endpoint string `json:"endpoint"`
+	// Available is false when the probe failed or was answered with a server error
+	Available bool `json:"available"`
+	// Latency is how long the probe took, in nanoseconds in JSON
+	Latency    time.Duration `json:"latency"`
+	ProbeError string        `json:"probe_error,omitempty"`
+	// Circuit is the state of the circuit breaker of the host of the upstream: closed, open or half-open
+	Circuit string `json:"circuit"`
+	// LastError is the error of the last failed call of a command to the upstream
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	CheckedAt   time.Time  `json:"checked_at"`
+}
+
+// ApiKeyHealth tells whether an API key a command relies on is configured
+type ApiKeyHealth struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	// Required is false when the command works without the key, though in a degraded way
+	Required   bool `json:"required"`
+	Configured bool `json:"configured"`
+}
+
+// HealthReport is the health of the upstreams and API keys of the initialized commands
+type HealthReport struct {
+	Upstreams []UpstreamHealth `json:"upstreams"`
+	ApiKeys   []ApiKeyHealth   `json:"api_keys"`
+}
+
+// Healthy tells whether every upstream is available and every required API key configured
+func (h HealthReport) Healthy() bool {
+	for _, upstream := range h.Upstreams {
+		if !upstream.Available {
+			return false
+		}
+	}
+	for _, key := range h.ApiKeys {
+		if key.Required && !key.Configured {
+			return false
+		}
+	}
+	return true
+}
+
+// apiKeyUsers are the API keys the commands rely on
+var apiKeyUsers = []ApiKeyHealth{
+	{Name: "openweather", Command: "weather"},
+	{Name: "youtube", Command: "youtube"},
+}
+
+type probe struct {
+	available bool
+	latency   time.Duration
+	err       string
+	at        time.Time
+}
+
+var (
+	probesLock sync.Mutex
+	probes     = map[string]probe{}
+	// probeClient bypasses the circuit breakers, which must only reflect the calls of the commands, and the metrics
+	probeClient = &http.Client{
+		Timeout:   healthProbeTimeout,
+		Transport: &userAgentTransport{base: http.DefaultTransport},
+	}
+)
+
+// probeEndpoint requests the base URL of an upstream, any answer but a server error meaning that it is available
+func probeEndpoint(ctx context.Context, endpoint string) probe {
+	probesLock.Lock()
+	last, ok := probes[endpoint]
+	probesLock.Unlock()
+	if ok && time.Since(last.at) < healthProbeTTL {
+		return last
+	}
+	result := probe{at: time.Now()}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err == nil {
+		var response *http.Response
+		response, err = probeClient.Do(request)
+		if err == nil {
+			_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, defaultMaxBodySize))
+			_ = response.Body.Close()
+			if response.StatusCode >= 500 {
+				err = &statusError{StatusCode: response.StatusCode, Status: response.Status}
+			}
+		}
+	}
+	result.latency = time.Since(result.at)
+	result.available = err == nil
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// the endpoint is known already
+		err = urlErr.Err
+	}
+	if err != nil {
+		result.err = redact(err.Error())
+	}
+	if ctx.Err() == nil {
+		probesLock.Lock()
+		probes[endpoint] = result
+		probesLock.Unlock()
+	}
+	return result
+}
+
+// configuredUpstreams returns the base URL of every upstream reached by the initialized commands,
+// the ones initialized last taking precedence
+func configuredUpstreams() map[string]string {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	endpoints := map[string]string{}
+	for i := len(configuredCommands) - 1; i >= 0; i-- {
+		configured := configuredCommands[i]
+		user, ok := configured.command.(upstreamUser)
+		if !ok {
+			continue
+		}
+		config := commandConfig{Config: currentConfig, executorKeys: configured.executorKeys}
+		for _, upstream := range user.upstreams() {
+			if _, ok := endpoints[upstream]; ok {
+				continue
+			}
+			if endpoint, err := config.endpoint(upstream); err == nil {
+				endpoints[upstream] = endpoint.String()
+			}
+		}
+	}
+	return endpoints
+}
+
+// apiKeyConfigured tells whether any initialized command has the API key named name
+func apiKeyConfigured(name string) bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	for _, configured := range configuredCommands {
+		if len(commandConfig{Config: currentConfig, executorKeys: configured.executorKeys}.apiKey(name)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHealth probes the given upstreams concurrently, all of them if upstreams is nil,
+// and checks the API keys of the given commands, all of them if commands is nil
+func checkHealth(ctx context.Context, upstreams []string, commands []string) HealthReport {
+	endpoints := configuredUpstreams()
+	if upstreams == nil {
+		for upstream := range endpoints {
+			upstreams = append(upstreams, upstream)
+		}
+	}
+	sort.Strings(upstreams)
+	var report HealthReport
+	var wg sync.WaitGroup
+	for _, upstream := range upstreams {
+		endpoint, ok := endpoints[upstream]
+		if !ok {
+			continue
+		}
+		report.Upstreams = append(report.Upstreams, UpstreamHealth{Upstream: upstream, Endpoint: endpoint})
+	}
+	for i := range report.Upstreams {
+		wg.Add(1)
+		go func(health *UpstreamHealth) {
+			defer wg.Done()
+			result := probeEndpoint(ctx, health.Endpoint)
+			health.Available, health.Latency, health.ProbeError, health.CheckedAt = result.available, result.latency, result.err, result.at
+			health.Circuit = string(circuitClosed)
+			host := health.Endpoint
+			if endpoint, err := parseEndpoint(health.Upstream, health.Endpoint); err == nil {
+				host = endpoint.Host
+			}
+			if breaker, ok := hostBreakers.lookup(host); ok {
+				health.Circuit = string(breaker.currentState())
+				if err, at := breaker.lastFailure(); err != nil {
+					health.LastError, health.LastErrorAt = redact(err.Error()), &at
+				}
+			}
+		}(&report.Upstreams[i])
+	}
+	for _, key := range apiKeyUsers {
+		if commands != nil && !containsFold(commands, key.Command) {
+			continue
+		}
+		key.Configured = apiKeyConfigured(key.Name)
+		report.ApiKeys = append(report.ApiKeys, key)
+	}
+	wg.Wait()
+	return report
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHealth probes every upstream reached by the initialized commands and checks the API keys they rely on
+func CheckHealth(ctx context.Context) HealthReport {
+	return checkHealth(ctx, nil, nil)
+}
+
+// HealthHandler serves the HealthReport as JSON, with a 503 status when it is not healthy
+func HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := CheckHealth(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Healthy() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+// StatusCommand reports the health of the upstreams and API keys of the commands
+type StatusCommand struct {
+	command.NoOpInterceptor
+	trigger  string
+	renderer Renderer
+	commands command.List
+}
+
+func (s *StatusCommand) Init(executor command.Executor) error {
+	if err := setUp(executor); err != nil {
+		return err
+	}
+	var err error
+	s.trigger = executor.Trigger()
+	s.commands = command.GetCommandList()
+	s.renderer, err = rendererFor(executor)
+	return err
+}
+
+func (s *StatusCommand) Name() string {
+	return "status"
+}
+
+func (s *StatusCommand) Aliases() []string {
+	return []string{"health"}
+}
+
+func (s *StatusCommand) Usage() string {
+	return "[command]"
+}
+
+func (s *StatusCommand) Description() string {
+	return "Checks whether the services the commands rely on are available and their API keys configured"
+}
+
+func (s *StatusCommand) Examples() []string {
+	return []string{"", "weather"}
+}
+
+func (s *StatusCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	return execute(s, command)
+}
+
+func (s *StatusCommand) ExecuteContext(ctx context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	var upstreams, commands []string
+	heading := "Status"
+	if len(command.Args()) > 0 {
+		name := strings.TrimPrefix(strings.ToLower(command.Args()[0]), s.trigger)
+		cmd := s.commands.Find(name)
+		if cmd == nil {
+			return nil, notFound("Unknown command %q, use %shelp to list them", name, s.trigger)
+		}
+		user, ok := cmd.(upstreamUser)
+		if !ok || len(user.upstreams()) == 0 {
+			return []*domain.ClientMessage{
+				domain.NewClientMessage(fmt.Sprintf("%s relies on no external service", cmd.Name()), command.Sender(), command.Private()),
+			}, nil
+		}
+		upstreams, commands = user.upstreams(), []string{cmd.Name()}
+		heading = "Status of " + cmd.Name()
+	}
+	report := checkHealth(ctx, upstreams, commands)
+	reply := Reply{Heading(heading)}
+	for _, upstream := range report.Upstreams {
+		reply = append(reply, Field{Name: upstream.Upstream, Value: describeUpstream(upstream)})
+	}
+	for _, key := range report.ApiKeys {
+		state := "configured"
+		switch {
+		case key.Configured:
+		case key.Required:
+			state = fmt.Sprintf("missing, %s cannot work without it", key.Command)
+		default:
+			state = fmt.Sprintf("missing, %s works in a degraded way", key.Command)
+		}
+		reply = append(reply, Field{Name: key.Name + " API key", Value: state})
+	}
+	return []*domain.ClientMessage{
+		domain.NewClientMessage(reply.Render(s.renderer), command.Sender(), command.Private()),
+	}, nil
+}
+
+func describeUpstream(upstream UpstreamHealth) string {
+	var description string
+	if upstream.Available {
+		description = fmt.Sprintf("available (%dms)", upstream.Latency.Milliseconds())
+	} else {
+		description = "unavailable: " + upstream.ProbeError
+	}
+	if upstream.Circuit != string(circuitClosed) {
+		description += ", calls suspended (circuit " + upstream.Circuit + ")"
+	}
+	if len(upstream.LastError) > 0 {
+		description += fmt.Sprintf(", last error %s ago: %s", time.Since(*upstream.LastErrorAt).Round(time.Second), upstream.LastError)
+	}
+	return description
+}
@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/raf924/connector-sdk/command"
+	"github.com/raf924/connector-sdk/domain"
+	"sort"
+	"strings"
+)
+
+var _ command.Command = (*HelpCommand)(nil)
+var _ ContextExecutable = (*HelpCommand)(nil)
+var _ Helper = (*HelpCommand)(nil)
+
+// Helper is implemented by commands documenting themselves for HelpCommand
+type Helper interface {
+	// Usage describes the arguments of the command, e.g. "<city> [c|f]"
+	Usage() string
+	// Description tells what the command does, in a sentence
+	Description() string
+	// Examples are argument strings the command can be called with
+	Examples() []string
+}
+
+// chatWatcher is implemented by commands which act upon chat messages rather than being called
+type chatWatcher interface {
+	watchesChat() bool
+}
+
+// HelpCommand lists the available commands, or details the usage of one of them
+type HelpCommand struct {
+	command.NoOpInterceptor
+	trigger  string
+	renderer Renderer
+	commands command.List
+}
+
+func (h *HelpCommand) Init(executor command.Executor) error {
+	if err := setUp(executor); err != nil {
+		return err
+	}
+	var err error
+	h.trigger = executor.Trigger()
+	h.commands = command.GetCommandList()
+	h.renderer, err = rendererFor(executor)
+	return err
+}
+
+func (h *HelpCommand) Name() string {
+	return "help"
+}
+
+func (h *HelpCommand) Aliases() []string {
+	return []string{"h", "commands"}
+}
+
+func (h *HelpCommand) Usage() string {
+	return "[command]"
+}
+
+func (h *HelpCommand) Description() string {
+	return "Lists the available commands, or shows how to use one of them"
+}
+
+func (h *HelpCommand) Examples() []string {
+	return []string{"", "weather"}
+}
+
+func (h *HelpCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	return execute(h, command)
+}
+
+func (h *HelpCommand) ExecuteContext(_ context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	var reply Reply
+	policy := policyOf(command.Sender(), command.Private())
+	if len(command.Args()) == 0 {
+		reply = h.summary(policy)
+	} else {
+		name := strings.TrimPrefix(strings.ToLower(command.Args()[0]), h.trigger)
+		cmd := h.commands.Find(name)
+		if cmd == nil {
+			return nil, notFound("Unknown command %q, use %s%s to list them", name, h.trigger, h.Name())
+		}
+		if !available(policy, cmd) {
+			return nil, notFound("%s is disabled here", cmd.Name())
+		}
+		reply = h.details(cmd, policy)
+	}
+	return []*domain.ClientMessage{
+		domain.NewClientMessage(reply.Render(h.renderer), command.Sender(), command.Private()),
+	}, nil
+}
+
+// summary lists every command available under policy with its aliases and description
+func (h *HelpCommand) summary(policy ChannelPolicy) Reply {
+	var entries []string
+	h.commands.Range(func(cmd command.Command) bool {
+		if !available(policy, cmd) {
+			return true
+		}
+		entry := h.trigger + cmd.Name()
+		var notes []string
+		if aliases := allowedAliases(policy, cmd); len(aliases) > 0 {
+			notes = append(notes, strings.Join(aliases, ", "))
+		}
+		if watchesChat(cmd) {
+			notes = append(notes, "passive")
+		}
+		if len(notes) > 0 {
+			entry += " (" + strings.Join(notes, "; ") + ")"
+		}
+		if helper, ok := cmd.(Helper); ok {
+			entry += ": " + helper.Description()
+		}
+		entries = append(entries, entry)
+		return true
+	})
+	sort.Strings(entries)
+	return Reply{
+		Heading("Commands"),
+		List(entries),
+		Text(fmt.Sprintf("Use %s%s <command> for details", h.trigger, h.Name())),
+	}
+}
+
+// details shows how to use cmd under policy
+func (h *HelpCommand) details(cmd command.Command, policy ChannelPolicy) Reply {
+	reply := Reply{Heading(cmd.Name())}
+	helper, ok := cmd.(Helper)
+	if ok {
+		reply = append(reply, Text(helper.Description()))
+	}
+	if aliases := allowedAliases(policy, cmd); len(aliases) > 0 {
+		reply = append(reply, Field{Name: "Aliases", Value: strings.Join(aliases, ", ")})
+	}
+	if !ok {
+		return append(reply, Text("No help available for this command"))
+	}
+	passive := watchesChat(cmd)
+	if passive {
+		reply = append(reply, Field{Name: "Passive", Value: "it acts upon chat messages, with no need to call it"})
+	}
+	if usage := helper.Usage(); !passive || len(usage) > 0 {
+		reply = append(reply, Field{Name: "Usage", Value: strings.TrimSpace(h.trigger + cmd.Name() + " " + usage)})
+	}
+	if examples := helper.Examples(); len(examples) > 0 {
+		lines := make([]string, len(examples))
+		for i, example := range examples {
+			if passive {
+				lines[i] = example
+			} else {
+				lines[i] = strings.TrimSpace(h.trigger + cmd.Name() + " " + example)
+			}
+		}
+		reply = append(reply, Heading("Examples"), List(lines))
+	}
+	return reply
+}
+
+// available tells whether cmd can be used under policy
+func available(policy ChannelPolicy, cmd command.Command) bool {
+	return policy.allows(cmd.Name(), "", watchesChat(cmd))
+}
+
+func allowedAliases(policy ChannelPolicy, cmd command.Command) []string {
+	var aliases []string
+	for _, alias := range cmd.Aliases() {
+		if policy.allows(cmd.Name(), alias, false) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+func watchesChat(cmd command.Command) bool {
+	watcher, ok := cmd.(chatWatcher)
+	return ok && watcher.watchesChat()
+}
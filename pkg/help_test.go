@@ -0,0 +1,25 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"testing"
+)
+
+func TestHelpCommand(t *testing.T) {
+	_, executor := newServer(t)
+	help := &pkg.HelpCommand{}
+	initCommand(t, help, executor)
+	alice := servicetest.NewUser("alice")
+	assertTexts(t, run(t, help, alice, "", false),
+		"Commands:\n"+
+			"- !help (h, commands): Lists the available commands, or shows how to use one of them\n"+
+			"- !joke (j): Tells a random joke\n"+
+			"- !status (health): Checks whether the services the commands rely on are available and their API keys configured\n"+
+			"- !urban (u): Defines a slang term with Urban Dictionary\n"+
+			"Use !help <command> for details")
+	assertTexts(t, run(t, help, alice, "urban", false),
+		"urban:\nDefines a slang term with Urban Dictionary\nAliases: u\nUsage: !urban <term>\nExamples:\n- !urban yeet")
+	assertTexts(t, run(t, help, alice, "!u", false), run(t, help, alice, "urban", false)...)
+	assertTexts(t, run(t, help, alice, "weather", false), "Unknown command \"weather\", use !help to list them")
+}
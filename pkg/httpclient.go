@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const userAgent = "TBotT (https://github.com/raf924/bot-services-cmd)"
+
+// defaultMaxBodySize is large enough for any API response the commands parse
+const defaultMaxBodySize = 1 << 20
+
+type statusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (s *statusError) Error() string {
+	return fmt.Sprintf("request status code: %d: %s", s.StatusCode, s.Status)
+}
+
+// userAgentTransport identifies the bot to upstreams, unless a request explicitly sets its own User-Agent
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (u *userAgentTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if len(request.Header.Get("User-Agent")) == 0 {
+		request = request.Clone(request.Context())
+		request.Header.Set("User-Agent", userAgent)
+	}
+	return u.base.RoundTrip(request)
+}
+
+// contextTransport binds requests to ctx, for clients that cannot be handed a context themselves
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (c *contextTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return c.base.RoundTrip(request.WithContext(c.ctx))
+}
+
+// httpClient is the client every command uses to reach its upstream.
+// It bounds each call with a timeout, limits the size of response bodies and rejects non 2xx responses.
+type httpClient struct {
+	client      *http.Client
+	maxBodySize int64
+}
+
+func newHttpClient(timeout time.Duration, maxBodySize int64) *httpClient {
+	return &httpClient{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &userAgentTransport{base: &observedTransport{base: &resilientTransport{base: http.DefaultTransport}}},
+		},
+		maxBodySize: maxBodySize,
+	}
+}
+
+// do sends request and returns the body of the response if its status code is a success
+func (c *httpClient) do(request *http.Request) ([]byte, error) {
+	response, err := c.client.Do(request.WithContext(withCaller(request.Context())))
+	var circuitErr *circuitOpenError
+	if errors.As(err, &circuitErr) {
+		return nil, circuitErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		// drain what is left of the body so that the connection can be reused
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, c.maxBodySize))
+		return nil, &statusError{StatusCode: response.StatusCode, Status: response.Status}
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, c.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > c.maxBodySize {
+		return nil, fmt.Errorf("response from %s exceeds %d bytes", request.URL.Host, c.maxBodySize)
+	}
+	return body, nil
+}
+
+func (c *httpClient) get(ctx context.Context, rawUrl string, header http.Header) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	return c.do(request)
+}
+
+func (c *httpClient) getJSON(ctx context.Context, rawUrl string, v interface{}) error {
+	body, err := c.get(ctx, rawUrl, http.Header{"Accept": []string{"application/json"}})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (c *httpClient) getXML(ctx context.Context, rawUrl string, v interface{}) error {
+	body, err := c.get(ctx, rawUrl, http.Header{"Accept": []string{"application/xml,text/xml"}})
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(body, v)
+}
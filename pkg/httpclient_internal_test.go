@@ -0,0 +1,39 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHttpClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/agent":
+			_, _ = writer.Write([]byte(request.UserAgent()))
+		case "/large":
+			_, _ = writer.Write([]byte(strings.Repeat("a", 65)))
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	defer server.Close()
+	client := newHttpClient(time.Second, 64)
+	if body, err := client.get(context.Background(), server.URL+"/agent", nil); err != nil || string(body) != userAgent {
+		t.Errorf("User-Agent = %q, %v, want %q", body, err, userAgent)
+	}
+	if body, _ := client.get(context.Background(), server.URL+"/agent", http.Header{"User-Agent": []string{"Mozilla/5.0"}}); string(body) != "Mozilla/5.0" {
+		t.Errorf("User-Agent = %q, want the one of the request", body)
+	}
+	if _, err := client.get(context.Background(), server.URL+"/large", nil); err == nil || !strings.Contains(err.Error(), "exceeds 64 bytes") {
+		t.Errorf("large body error = %v, want the size limit exceeded", err)
+	}
+	var statusErr *statusError
+	if _, err := client.get(context.Background(), server.URL+"/missing", nil); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("missing error = %v, want a 404 status error", err)
+	}
+}
@@ -0,0 +1,163 @@
+package pkg
+
+import (
+	"context"
+	"github.com/raf924/connector-sdk/domain"
+	"sync"
+	"time"
+)
+
+// invocationTimeout bounds the whole execution of a command, all upstream calls included
+const invocationTimeout = 30 * time.Second
+
+// ContextExecutable is implemented by commands whose executions carry a context.Context.
+// The context is done when the invocation times out, when its sender cancels it or when Shutdown is called.
+type ContextExecutable interface {
+	ExecuteContext(ctx context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error)
+}
+
+// ContextInterceptor is the ContextExecutable counterpart for commands handling chat messages
+type ContextInterceptor interface {
+	OnChatContext(ctx context.Context, message *domain.ChatMessage) ([]*domain.ClientMessage, error)
+}
+
+var rootContext, shutdown = context.WithCancel(context.Background())
+
+// Shutdown cancels every running and future invocation of the commands in pkg, and persists the cache if it is
+func Shutdown() {
+	shutdown()
+	persistCache(currentCache())
+}
+
+type invocationRegistry struct {
+	m       sync.Mutex
+	next    uint64
+	cancels map[string]map[uint64]context.CancelFunc
+}
+
+var runningInvocations = &invocationRegistry{cancels: map[string]map[uint64]context.CancelFunc{}}
+
+func userKey(user *domain.User) string {
+	if user == nil {
+		return ""
+	}
+	if len(user.Id()) > 0 {
+		return user.Id()
+	}
+	return user.Nick()
+}
+
+// start registers a new invocation for user. The returned function must be called once the invocation is over.
+func (r *invocationRegistry) start(user *domain.User, timeout time.Duration) (context.Context, func()) {
+	ctx, cancel := context.WithTimeout(rootContext, timeout)
+	key := userKey(user)
+	r.m.Lock()
+	id := r.next
+	r.next++
+	if r.cancels[key] == nil {
+		r.cancels[key] = map[uint64]context.CancelFunc{}
+	}
+	r.cancels[key][id] = cancel
+	r.m.Unlock()
+	return ctx, func() {
+		r.m.Lock()
+		delete(r.cancels[key], id)
+		if len(r.cancels[key]) == 0 {
+			delete(r.cancels, key)
+		}
+		r.m.Unlock()
+		cancel()
+	}
+}
+
+// cancel cancels the running invocations of user and returns how many there were
+func (r *invocationRegistry) cancel(user *domain.User) int {
+	key := userKey(user)
+	r.m.Lock()
+	cancels := r.cancels[key]
+	delete(r.cancels, key)
+	r.m.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+	return len(cancels)
+}
+
+// invocation is a single run of a command, triggered either by a command message or by a chat message
+type invocation struct {
+	ctx     context.Context
+	command namedCommand
+	// alias is the name the command was called with, empty for passive invocations
+	alias   string
+	sender  *domain.User
+	private bool
+	// passive is true when the invocation was triggered by a chat message rather than explicitly
+	passive bool
+	// logger tags the records of the invocation with its request ID and the name of its command
+	logger *Logger
+	run    func(ctx context.Context) ([]*domain.ClientMessage, error)
+}
+
+type namedCommand interface {
+	Name() string
+}
+
+type handler func(inv *invocation) ([]*domain.ClientMessage, error)
+
+// middleware wraps the handling of every invocation, e.g. to reject or post-process it
+type middleware func(next handler) handler
+
+// middlewares are applied to invocations in order, the first one being the outermost
+var middlewares = []middleware{applyPolicy, rateLimit, limitReplies, friendlyErrors, recordMetrics, logInvocations}
+
+func runInvocation(inv *invocation) ([]*domain.ClientMessage, error) {
+	inv.logger = currentLogger().With("request_id", newRequestId(), "command", inv.command.Name(), "passive", inv.passive)
+	inv.ctx = withLogger(inv.ctx, inv.logger)
+	h := func(inv *invocation) ([]*domain.ClientMessage, error) {
+		return inv.run(inv.ctx)
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h(inv)
+}
+
+type contextCommand interface {
+	namedCommand
+	ContextExecutable
+}
+
+type contextInterceptor interface {
+	namedCommand
+	ContextInterceptor
+}
+
+func execute(executable contextCommand, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	ctx, done := runningInvocations.start(command.Sender(), invocationTimeout)
+	defer done()
+	return runInvocation(&invocation{
+		ctx:     ctx,
+		command: executable,
+		alias:   command.Command(),
+		sender:  command.Sender(),
+		private: command.Private(),
+		run: func(ctx context.Context) ([]*domain.ClientMessage, error) {
+			return executable.ExecuteContext(ctx, command)
+		},
+	})
+}
+
+func onChat(interceptor contextInterceptor, message *domain.ChatMessage) ([]*domain.ClientMessage, error) {
+	ctx, done := runningInvocations.start(message.Sender(), invocationTimeout)
+	defer done()
+	return runInvocation(&invocation{
+		ctx:     ctx,
+		command: interceptor,
+		sender:  message.Sender(),
+		private: message.Private(),
+		passive: true,
+		run: func(ctx context.Context) ([]*domain.ClientMessage, error) {
+			return interceptor.OnChatContext(ctx, message)
+		},
+	})
+}
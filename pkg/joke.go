@@ -1,17 +1,22 @@
 package pkg
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
-	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"sync/atomic"
 	"time"
 )
 
 var _ command.Command = (*JokeCommand)(nil)
+var _ Helper = (*JokeCommand)(nil)
+var _ ContextExecutable = (*JokeCommand)(nil)
+
+const jokeTimeout = 5 * time.Second
 
 type joke struct {
 	Kind string `json:"kind"`
@@ -30,14 +35,48 @@ type jokesResponse struct {
 	} `json:"data"`
 }
 
+// jokeSettings are the settings of JokeCommand coming from the Config
+type jokeSettings struct {
+	jokeSources []string
+	redditUrl   *url.URL
+	dadJokeUrl  *url.URL
+}
+
 type JokeCommand struct {
 	command.NoOpInterceptor
-	jokeSources []func() (string, error)
+	current  atomic.Value
+	client   *httpClient
+	renderer Renderer
 }
 
-func (j *JokeCommand) Init(_ command.Executor) error {
-	j.jokeSources = append(j.jokeSources, j.fetchDadJoke, j.fetchFromReddit)
-	return nil
+func (j *JokeCommand) Init(executor command.Executor) error {
+	if err := setUp(executor); err != nil {
+		return err
+	}
+	var err error
+	j.client = newHttpClient(jokeTimeout, defaultMaxBodySize)
+	j.renderer, err = rendererFor(executor)
+	if err != nil {
+		return err
+	}
+	return configureCommand(j, executor)
+}
+
+func (j *JokeCommand) configure(config commandConfig) (func(), error) {
+	redditUrl, err := config.endpoint(redditUpstream)
+	if err != nil {
+		return nil, err
+	}
+	dadJokeUrl, err := config.endpoint(dadJokeUpstream)
+	if err != nil {
+		return nil, err
+	}
+	settings := &jokeSettings{jokeSources: config.Joke.Sources, redditUrl: redditUrl, dadJokeUrl: dadJokeUrl}
+	return func() { j.current.Store(settings) }, nil
+}
+
+func (j *JokeCommand) settings() *jokeSettings {
+	return j.current.Load().(*jokeSettings)
 }
 
 func (j *JokeCommand) Name() string {
@@ -48,65 +87,73 @@ func (j *JokeCommand) Aliases() []string {
 	return []string{"j"}
 }
 
-func (j *JokeCommand) fetchFromReddit() (string, error) {
-	req, _ := http.NewRequest("GET", "https://www.reddit.com/r/jokes/.json", nil)
-	req.Header.Set("TE", "Trailers")
-	req.Header.Set("Accept", "text/json,application/json")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:89.0) Gecko/20100101 Firefox/89.0")
-	req.Header.Set("Host", "www.reddit.com")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("request status code: %d: %s", resp.StatusCode, resp.Status)
+func (j *JokeCommand) Usage() string {
+	return ""
+}
+
+func (j *JokeCommand) Description() string {
+	return "Tells a random joke"
+}
+
+func (j *JokeCommand) Examples() []string {
+	return nil
+}
+
+func (j *JokeCommand) upstreams() []string {
+	return j.settings().jokeSources
+}
+
+// fetcher returns the function fetching a joke from source
+func (j *JokeCommand) fetcher(source string) func(ctx context.Context) (string, error) {
+	if source == redditUpstream {
+		return j.fetchFromReddit
 	}
+	return j.fetchDadJoke
+}
+
+func (j *JokeCommand) fetchFromReddit(ctx context.Context) (string, error) {
 	var jr jokesResponse
-	err = json.NewDecoder(resp.Body).Decode(&jr)
+	err := j.client.getJSON(ctx, endpointUrl(j.settings().redditUrl, "r", "jokes", ".json").String(), &jr)
 	if err != nil {
-		return "", err
+		return "", upstreamError(redditUpstream, err)
+	}
+	if jr.Data.Count == 0 || len(jr.Data.Children) < jr.Data.Count {
+		return "", &Error{Kind: UpstreamUnavailable, Upstream: redditUpstream, Err: fmt.Errorf("no joke in listing")}
 	}
 	jokeIndex := rand.Intn(jr.Data.Count)
 	joke := jr.Data.Children[jokeIndex].Data
 	return fmt.Sprintf("%s\n%s - %s", joke.Title, joke.Selftext, joke.Url), nil
 }
 
-func (j *JokeCommand) fetchDadJoke() (string, error) {
-	req, _ := http.NewRequest("GET", "https://icanhazdadjoke.com/", nil)
-	req.Header.Set("Accept", "text/plain")
-	req.Header.Set("User-Agent", "TBotT (https://github.com/raf924/bot-services-cmd)")
-	resp, err := http.DefaultClient.Do(req)
+func (j *JokeCommand) fetchDadJoke(ctx context.Context) (string, error) {
+	b, err := j.client.get(ctx, j.settings().dadJokeUrl.String(), http.Header{"Accept": []string{"text/plain"}})
 	if err != nil {
-		return "", err
-	}
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("request status code: %d: %s", resp.StatusCode, resp.Status)
-
-	}
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+		return "", upstreamError(dadJokeUpstream, err)
 	}
 	return string(b), nil
 }
 
 func (j *JokeCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
-	var jokeSources = []func() (string, error){j.fetchDadJoke, j.fetchFromReddit}
+	return execute(j, command)
+}
+
+func (j *JokeCommand) ExecuteContext(ctx context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	jokeSources := append([]string(nil), j.settings().jokeSources...)
 	rand.Seed(time.Now().Unix())
 	err := fmt.Errorf("no joke source chosen")
 	var joke string
 	for len(jokeSources) > 0 && err != nil {
 		sourceChoice := rand.Intn(len(jokeSources))
-		joke, err = jokeSources[sourceChoice]()
+		joke, err = j.fetcher(jokeSources[sourceChoice])(ctx)
 		if err != nil {
 			jokeSources = append(jokeSources[:sourceChoice], jokeSources[sourceChoice+1:]...)
 		}
 	}
 	if err != nil {
-		return nil, err
+		return nil, explain(err, UpstreamUnavailable, "No joke could be fetched, please try again later")
 	}
 
 	return []*domain.ClientMessage{
-		domain.NewClientMessage(joke, command.Sender(), command.Private()),
+		domain.NewClientMessage(Reply{Text(joke)}.Render(j.renderer), command.Sender(), command.Private()),
 	}, nil
 }
@@ -0,0 +1,42 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"net/http"
+	"testing"
+)
+
+func TestJokeCommand(t *testing.T) {
+	server, executor := newServer(t)
+	server.Fail("dadjoke", http.StatusServiceUnavailable)
+	joke := &pkg.JokeCommand{}
+	initCommand(t, joke, executor)
+	// the joke is picked at random among the recorded ones
+	texts := run(t, joke, servicetest.NewUser("alice"), "", false)
+	jokes := map[string]bool{
+		"Why do programmers wear glasses?\nBecause they can't C#. - https://www.reddit.com/r/Jokes/comments/abc1/": true,
+		"Why did the developer go broke?\nIt had too many bugs. - https://www.reddit.com/r/Jokes/comments/abc2/":   true,
+	}
+	if len(texts) != 1 || !jokes[texts[0]] {
+		t.Errorf("texts = %q, want one of the recorded reddit jokes", texts)
+	}
+}
+
+func TestJokeCommandFallsBack(t *testing.T) {
+	server, executor := newServer(t)
+	server.Fail("reddit", http.StatusServiceUnavailable)
+	joke := &pkg.JokeCommand{}
+	initCommand(t, joke, executor)
+	assertTexts(t, run(t, joke, servicetest.NewUser("alice"), "", false),
+		"I'm reading a book about anti-gravity. It's impossible to put down.")
+}
+
+func TestJokeCommandUnavailable(t *testing.T) {
+	server, executor := newServer(t)
+	server.Fail("reddit", http.StatusServiceUnavailable)
+	server.Fail("dadjoke", http.StatusServiceUnavailable)
+	joke := &pkg.JokeCommand{}
+	initCommand(t, joke, executor)
+	assertTexts(t, run(t, joke, servicetest.NewUser("alice"), "", false), "No joke could be fetched, please try again later")
+}
@@ -0,0 +1,298 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/raf924/connector-sdk/domain"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log record
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// ParseLevel returns the Level named s, e.g. "debug" or "WARN"
+func ParseLevel(s string) (Level, error) {
+	for level := LevelDebug; level <= LevelError; level++ {
+		if strings.EqualFold(s, level.String()) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// sensitiveParameter matches the query parameters holding credentials, whose values must never be logged
+var sensitiveParameter = regexp.MustCompile(`(?i)\b(appid|key|api_key|apikey|token|access_token)=[^&\s"]*`)
+
+// redact hides the credentials s may hold, e.g. in the URL of an upstream error
+func redact(s string) string {
+	return sensitiveParameter.ReplaceAllString(s, "${1}=REDACTED")
+}
+
+// errorText is the text of err without the path and query of the URL it failed to reach, if any,
+// as they hold what users asked for, e.g. the city of a forecast or the term looked up
+func errorText(err error) string {
+	s := err.Error()
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && len(urlErr.URL) > 0 {
+		host := "URL"
+		if u, parseErr := url.Parse(urlErr.URL); parseErr == nil {
+			host = u.Scheme + "://" + u.Host
+		}
+		s = strings.Replace(s, urlErr.URL, host, -1)
+	}
+	return s
+}
+
+// Logger writes structured records, each of them being a line of key=value pairs.
+// Arguments following the message of a record alternate keys and values, as do the ones given to With.
+type Logger struct {
+	output *syncWriter
+	level  Level
+	attrs  string
+}
+
+type syncWriter struct {
+	m sync.Mutex
+	w io.Writer
+}
+
+// NewLogger returns a Logger writing the records of at least level to output
+func NewLogger(output io.Writer, level Level) *Logger {
+	return &Logger{output: &syncWriter{w: output}, level: level}
+}
+
+// With returns a Logger adding args to every record
+func (l *Logger) With(args ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	with := *l
+	with.attrs += formatAttrs(args)
+	return &with
+}
+
+func (l *Logger) Debug(msg string, args ...interface{}) {
+	l.log(LevelDebug, msg, args)
+}
+
+func (l *Logger) Info(msg string, args ...interface{}) {
+	l.log(LevelInfo, msg, args)
+}
+
+func (l *Logger) Warn(msg string, args ...interface{}) {
+	l.log(LevelWarn, msg, args)
+}
+
+func (l *Logger) Error(msg string, args ...interface{}) {
+	l.log(LevelError, msg, args)
+}
+
+// Enabled tells whether records of level are written
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.level
+}
+
+func (l *Logger) log(level Level, msg string, args []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var record strings.Builder
+	record.WriteString("time=")
+	record.WriteString(time.Now().UTC().Format(time.RFC3339Nano))
+	record.WriteString(" level=")
+	record.WriteString(level.String())
+	record.WriteString(" msg=")
+	record.WriteString(formatValue(msg))
+	record.WriteString(l.attrs)
+	record.WriteString(formatAttrs(args))
+	record.WriteString("\n")
+	l.output.m.Lock()
+	_, _ = io.WriteString(l.output.w, record.String())
+	l.output.m.Unlock()
+}
+
+func formatAttrs(args []interface{}) string {
+	var attrs strings.Builder
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok || i+1 == len(args) {
+			// a value without its key, as slog does
+			attrs.WriteString(" !BADKEY=")
+			attrs.WriteString(formatValue(args[i]))
+			i--
+			continue
+		}
+		attrs.WriteString(" ")
+		attrs.WriteString(key)
+		attrs.WriteString("=")
+		attrs.WriteString(formatValue(args[i+1]))
+	}
+	return attrs.String()
+}
+
+func formatValue(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case error:
+		s = errorText(v)
+	case time.Duration:
+		s = v.Round(time.Microsecond).String()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	s = redact(s)
+	if len(s) == 0 || strings.ContainsAny(s, " =\"\n\t") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+var (
+	loggerLock    sync.RWMutex
+	packageLogger = NewLogger(os.Stderr, LevelInfo)
+)
+
+// SetLogger replaces the logger of the commands, nil disabling logging
+func SetLogger(logger *Logger) {
+	loggerLock.Lock()
+	packageLogger = logger
+	loggerLock.Unlock()
+}
+
+func currentLogger() *Logger {
+	loggerLock.RLock()
+	defer loggerLock.RUnlock()
+	return packageLogger
+}
+
+type loggerKey struct{}
+
+func withLogger(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the logger of the invocation ctx belongs to, which tags records with its request ID
+func loggerFrom(ctx context.Context) *Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return logger
+	}
+	return currentLogger()
+}
+
+var requestCount uint64
+
+// newRequestId returns an ID telling apart the records of concurrent invocations
+func newRequestId() string {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatUint(atomic.AddUint64(&requestCount, 1), 16)
+	}
+	return hex.EncodeToString(id)
+}
+
+// observedTransport records the latency and outcome of every upstream call, in logs and metrics
+type observedTransport struct {
+	base http.RoundTripper
+}
+
+func (o *observedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	logger := loggerFrom(request.Context())
+	start := time.Now()
+	response, err := o.base.RoundTrip(request)
+	duration := time.Since(start)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(response.StatusCode)
+	}
+	upstreamDuration.observe(duration.Seconds(), request.URL.Host, status)
+	// the path often holds what users asked for, e.g. the word looked up in the dictionary, hence is only debugged
+	logger.Debug("upstream call path", "upstream", request.URL.Host, "path", request.URL.Path)
+	if !logger.Enabled(LevelInfo) {
+		return response, err
+	}
+	args := []interface{}{"upstream", request.URL.Host, "duration", duration}
+	switch {
+	case err != nil:
+		logger.Warn("upstream call failed", append(args, "outcome", "error", "err", err)...)
+	case isUpstreamFailure(response, nil):
+		logger.Warn("upstream call failed", append(args, "outcome", "status", "status", response.StatusCode)...)
+	case response.StatusCode < 200 || response.StatusCode > 299:
+		// e.g. a 404 meaning that nothing was found
+		logger.Info("upstream call", append(args, "outcome", "status", "status", response.StatusCode)...)
+	default:
+		logger.Info("upstream call", append(args, "outcome", "ok", "status", response.StatusCode)...)
+	}
+	return response, err
+}
+
+// logInvocations records the duration and outcome of every invocation reaching the command
+func logInvocations(next handler) handler {
+	return func(inv *invocation) ([]*domain.ClientMessage, error) {
+		start := time.Now()
+		messages, err := next(inv)
+		args := []interface{}{"duration", time.Since(start), "outcome", outcome(err)}
+		var typed *Error
+		switch {
+		case err == nil:
+			inv.logger.Info("invocation", append(args, "replies", len(messages))...)
+		case errors.As(err, &typed) && (typed.Kind == NotFound || typed.Kind == BadInput):
+			// the reason of such errors quotes what users asked for, which is none of the operators' business
+			inv.logger.Info("invocation", args...)
+		default:
+			inv.logger.Warn("invocation failed", append(args, "err", err)...)
+		}
+		return messages, err
+	}
+}
+
+func outcome(err error) string {
+	var typed *Error
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &typed):
+		return string(typed.Kind)
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "error"
+}
@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLoggerRecords(t *testing.T) {
+	var output bytes.Buffer
+	logger := NewLogger(&output, LevelInfo).With("request_id", "abc")
+	logger.Debug("hidden")
+	logger.Info("upstream call", "upstream", "api.qwant.com", "outcome", "ok")
+	record := output.String()
+	if strings.Contains(record, "hidden") {
+		t.Errorf("record %q, want debug records left out at info level", record)
+	}
+	if !strings.Contains(record, ` level=INFO msg="upstream call" request_id=abc upstream=api.qwant.com outcome=ok`+"\n") {
+		t.Errorf("record %q, want the level, message and key=value pairs", record)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	got := redact("https://api.openweathermap.org/data/2.5/weather?lat=1&appid=secret&units=metric key=abc")
+	if want := "https://api.openweathermap.org/data/2.5/weather?lat=1&appid=REDACTED&units=metric key=REDACTED"; got != want {
+		t.Errorf("redact() = %s, want %s", got, want)
+	}
+}
+
+func TestFormatValueDropsErrorUrls(t *testing.T) {
+	err := upstreamError(geocodingUpstream, &url.Error{
+		Op:  "Get",
+		URL: "https://geocode.maps.co/search?q=my+street&api_key=secret",
+		Err: errors.New("context deadline exceeded"),
+	})
+	got := formatValue(err)
+	for _, leaked := range []string{"my+street", "secret", "/search"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("formatValue() = %s, want %s left out", got, leaked)
+		}
+	}
+	if !strings.Contains(got, `https://geocode.maps.co`) || !strings.Contains(got, "context deadline exceeded") {
+		t.Errorf("formatValue() = %s, want the host and the cause of the failure", got)
+	}
+}
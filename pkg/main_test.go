@@ -0,0 +1,70 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"github.com/raf924/connector-sdk/command"
+	"github.com/raf924/connector-sdk/domain"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestMain sets up pkg once, with rate limits no test reaches, since the tests share its buckets,
+// and registers the commands help and status know about
+func TestMain(m *testing.M) {
+	pkg.SetLogger(nil)
+	for _, cmd := range []command.Command{&pkg.UrbanCommand{}, &pkg.JokeCommand{}, &pkg.HelpCommand{}, &pkg.StatusCommand{}} {
+		command.HandleCommand(cmd)
+	}
+	if err := (&pkg.CancelCommand{}).Init(servicetest.NewExecutor(nil)); err != nil {
+		panic(err)
+	}
+	config := pkg.DefaultConfig()
+	unlimited := pkg.RateLimit{PerMinute: 6000, Burst: 1000}
+	config.RateLimits = pkg.RateLimitsConfig{User: unlimited, Channel: unlimited, Upstream: unlimited}
+	if err := pkg.SetConfig(config); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newServer starts a server replaying the recorded fixtures, closed at the end of the test, and returns an executor
+// pointing at it. The cache is emptied so that no response comes from a previous test.
+func newServer(t *testing.T) (*servicetest.Server, *servicetest.Executor) {
+	t.Helper()
+	pkg.SetCache(pkg.NewMemoryCache(100))
+	server := servicetest.NewServer()
+	t.Cleanup(server.Close)
+	executor := server.Executor()
+	executor.Keys["format"] = "plain"
+	return server, executor
+}
+
+// initCommand initializes cmd with executor, failing the test if it cannot be
+func initCommand(t *testing.T, cmd command.Command, executor command.Executor) {
+	t.Helper()
+	if err := cmd.Init(executor); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+}
+
+// run returns the texts of the answer of cmd to sender typing it followed by argString
+func run(t *testing.T, cmd command.Command, sender *domain.User, argString string, private bool) []string {
+	t.Helper()
+	messages, err := cmd.Execute(servicetest.NewCommandMessage(sender, cmd.Name(), argString, private))
+	if err != nil {
+		t.Fatalf("Execute(%q) error = %v", argString, err)
+	}
+	return servicetest.Texts(messages)
+}
+
+func assertTexts(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(want) == 0 {
+		want = []string{}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("texts = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,282 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/raf924/connector-sdk/domain"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metric is written in the Prometheus text exposition format
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	metricsLock sync.RWMutex
+	metrics     []metric
+)
+
+func register(m metric) {
+	metricsLock.Lock()
+	metrics = append(metrics, m)
+	metricsLock.Unlock()
+}
+
+// series holds the label values of a sample, keyed by their joined form
+type series struct {
+	key    string
+	values []string
+}
+
+func newSeries(labels []string, values []string) series {
+	if len(values) != len(labels) {
+		panic(fmt.Sprintf("expected %d label values, got %d", len(labels), len(values)))
+	}
+	return series{key: strings.Join(values, "\xff"), values: values}
+}
+
+func formatLabels(labels []string, values []string, extra ...string) string {
+	pairs := make([]string, 0, len(labels)+len(extra)/2)
+	for i, label := range labels {
+		pairs = append(pairs, label+"="+strconv.Quote(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// counter is a monotonically increasing value per combination of its labels
+type counter struct {
+	name   string
+	help   string
+	labels []string
+	m      sync.Mutex
+	series map[string]series
+	values map[string]float64
+}
+
+func newCounter(name string, help string, labels ...string) *counter {
+	c := &counter{name: name, help: help, labels: labels, series: map[string]series{}, values: map[string]float64{}}
+	register(c)
+	return c
+}
+
+func (c *counter) inc(values ...string) {
+	s := newSeries(c.labels, values)
+	c.m.Lock()
+	c.series[s.key] = s
+	c.values[s.key]++
+	c.m.Unlock()
+}
+
+func (c *counter) write(w io.Writer) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.series) {
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, c.series[key].values), formatFloat(c.values[key]))
+	}
+}
+
+// histogram counts observations in cumulative buckets per combination of its labels
+type histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	m       sync.Mutex
+	series  map[string]series
+	counts  map[string][]uint64
+	sums    map[string]float64
+}
+
+// latencyBuckets suit durations in seconds, from a cache hit to a timed out call
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+func newHistogram(name string, help string, buckets []float64, labels ...string) *histogram {
+	h := &histogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]series{},
+		counts:  map[string][]uint64{},
+		sums:    map[string]float64{},
+	}
+	register(h)
+	return h
+}
+
+func (h *histogram) observe(value float64, values ...string) {
+	s := newSeries(h.labels, values)
+	h.m.Lock()
+	defer h.m.Unlock()
+	counts, ok := h.counts[s.key]
+	if !ok {
+		// the last count is the one of the +Inf bucket
+		counts = make([]uint64, len(h.buckets)+1)
+		h.counts[s.key] = counts
+		h.series[s.key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			counts[i]++
+		}
+	}
+	counts[len(h.buckets)]++
+	h.sums[s.key] += value
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		values := h.series[key].values
+		counts := h.counts[key]
+		for i, bound := range h.buckets {
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", formatFloat(bound)), counts[i])
+		}
+		total := counts[len(h.buckets)]
+		_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", "+Inf"), total)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, values), formatFloat(h.sums[key]))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, values), total)
+	}
+}
+
+// gaugeFunc reports values computed when metrics are written
+type gaugeFunc struct {
+	name    string
+	help    string
+	labels  []string
+	collect func() []gaugeSample
+}
+
+type gaugeSample struct {
+	values []string
+	value  float64
+}
+
+func newGaugeFunc(name string, help string, collect func() []gaugeSample, labels ...string) *gaugeFunc {
+	g := &gaugeFunc{name: name, help: help, labels: labels, collect: collect}
+	register(g)
+	return g
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	samples := g.collect()
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].values, "\xff") < strings.Join(samples[j].values, "\xff")
+	})
+	for _, sample := range samples {
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, sample.values), formatFloat(sample.value))
+	}
+}
+
+func sortedKeys(m map[string]series) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	invocationsTotal = newCounter("bot_command_invocations_total",
+		"Invocations of each command, by the name it was called with.", "command", "alias")
+	invocationErrors = newCounter("bot_command_errors_total",
+		"Invocations that failed, by kind of error.", "command", "kind")
+	invocationDuration = newHistogram("bot_command_duration_seconds",
+		"Duration of the invocations of each command.", latencyBuckets, "command")
+	rateLimitedTotal = newCounter("bot_command_rate_limited_total",
+		"Invocations rejected because of rate limits.", "command")
+	upstreamDuration = newHistogram("bot_upstream_request_duration_seconds",
+		"Latency of the calls to each upstream host, by status code or \"error\".", latencyBuckets, "upstream", "status")
+	cacheLookups = newCounter("bot_cache_lookups_total",
+		"Lookups of upstream responses in the cache, whose hit ratio is hit over all results.", "upstream", "result")
+	_ = newGaugeFunc("bot_upstream_circuit_open",
+		"Whether calls to each upstream host are currently stopped by its circuit breaker.",
+		func() []gaugeSample {
+			var samples []gaugeSample
+			for host, state := range hostBreakers.states() {
+				open := 0.0
+				if state != circuitClosed {
+					open = 1
+				}
+				samples = append(samples, gaugeSample{values: []string{host}, value: open})
+			}
+			return samples
+		}, "upstream")
+)
+
+// recordMetrics counts the invocations reaching the command along with their duration and failures
+func recordMetrics(next handler) handler {
+	return func(inv *invocation) ([]*domain.ClientMessage, error) {
+		alias := inv.alias
+		if len(alias) == 0 {
+			alias = inv.command.Name()
+		}
+		invocationsTotal.inc(inv.command.Name(), alias)
+		start := time.Now()
+		messages, err := next(inv)
+		invocationDuration.observe(time.Since(start).Seconds(), inv.command.Name())
+		if err != nil {
+			invocationErrors.inc(inv.command.Name(), outcome(err))
+		}
+		return messages, err
+	}
+}
+
+// WriteMetrics writes every metric of the commands in the Prometheus text exposition format
+func WriteMetrics(w io.Writer) {
+	metricsLock.RLock()
+	defer metricsLock.RUnlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// MetricsHandler serves the metrics of the commands to Prometheus scrapers
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteMetrics(writer)
+	})
+}
+
+// ServeMetrics exposes the metrics under /metrics and the HealthReport under /health on addr, e.g. "localhost:9100",
+// until the returned server is closed
+func ServeMetrics(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot serve metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+	mux.Handle("/health", HealthHandler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			currentLogger().Error("metrics server stopped", "addr", addr, "err", err)
+		}
+	}()
+	currentLogger().Info("serving metrics", "addr", listener.Addr().String())
+	return server, nil
+}
@@ -0,0 +1,41 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCounterWrite(t *testing.T) {
+	c := &counter{name: "test_total", help: "Test.", labels: []string{"command"}, series: map[string]series{}, values: map[string]float64{}}
+	c.inc("wiki")
+	c.inc("urban")
+	c.inc("wiki")
+	var output bytes.Buffer
+	c.write(&output)
+	want := "# HELP test_total Test.\n# TYPE test_total counter\n" +
+		"test_total{command=\"urban\"} 1\ntest_total{command=\"wiki\"} 2\n"
+	if output.String() != want {
+		t.Errorf("write() = %q, want %q", output.String(), want)
+	}
+}
+
+func TestHistogramWrite(t *testing.T) {
+	h := &histogram{
+		name: "test_seconds", help: "Test.", labels: []string{"command"}, buckets: []float64{0.1, 1},
+		series: map[string]series{}, counts: map[string][]uint64{}, sums: map[string]float64{},
+	}
+	h.observe(0.05, "wiki")
+	h.observe(0.5, "wiki")
+	h.observe(2, "wiki")
+	var output bytes.Buffer
+	h.write(&output)
+	want := "# HELP test_seconds Test.\n# TYPE test_seconds histogram\n" +
+		"test_seconds_bucket{command=\"wiki\",le=\"0.1\"} 1\n" +
+		"test_seconds_bucket{command=\"wiki\",le=\"1\"} 2\n" +
+		"test_seconds_bucket{command=\"wiki\",le=\"+Inf\"} 3\n" +
+		"test_seconds_sum{command=\"wiki\"} 2.55\n" +
+		"test_seconds_count{command=\"wiki\"} 3\n"
+	if output.String() != want {
+		t.Errorf("write() = %q, want %q", output.String(), want)
+	}
+}
@@ -0,0 +1,30 @@
+package pkg_test
+
+import (
+	"bytes"
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	_, executor := newServer(t)
+	urban := &pkg.UrbanCommand{}
+	initCommand(t, urban, executor)
+	messages, err := urban.Execute(servicetest.NewCommandMessage(servicetest.NewUser("alice"), "u", "yeet", false))
+	if err != nil || len(messages) == 0 {
+		t.Fatalf("Execute() = %v, %v, want a definition", messages, err)
+	}
+	var output bytes.Buffer
+	pkg.WriteMetrics(&output)
+	for _, want := range []string{
+		`bot_command_invocations_total{command="urban",alias="u"} `,
+		`bot_command_duration_seconds_count{command="urban"} `,
+		`bot_cache_lookups_total{upstream="urban",result="miss"} `,
+	} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"context"
+	"github.com/raf924/connector-sdk/command"
+	"github.com/raf924/connector-sdk/domain"
+)
+
+var _ command.Command = (*MoreCommand)(nil)
+var _ Helper = (*MoreCommand)(nil)
+var _ ContextExecutable = (*MoreCommand)(nil)
+
+// MoreCommand shows the next page of the last paginated result of its sender
+type MoreCommand struct {
+	command.NoOpInterceptor
+	trigger  string
+	renderer Renderer
+}
+
+func (m *MoreCommand) Init(executor command.Executor) error {
+	if err := setUp(executor); err != nil {
+		return err
+	}
+	var err error
+	m.trigger = executor.Trigger()
+	m.renderer, err = rendererFor(executor)
+	return err
+}
+
+func (m *MoreCommand) Name() string {
+	return "more"
+}
+
+func (m *MoreCommand) Aliases() []string {
+	return []string{"next"}
+}
+
+func (m *MoreCommand) Usage() string {
+	return ""
+}
+
+func (m *MoreCommand) Description() string {
+	return "Shows the next page of your last paginated result"
+}
+
+func (m *MoreCommand) Examples() []string {
+	return nil
+}
+
+// invocationUpstreams are the upstreams the next page of the sender of inv may call
+func (m *MoreCommand) invocationUpstreams(inv *invocation) []string {
+	return paginatedResults.upstreams(inv.sender, inv.private)
+}
+
+func (m *MoreCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	return execute(m, command)
+}
+
+func (m *MoreCommand) ExecuteContext(ctx context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	next, remaining, pop, ok := paginatedResults.next(command.Sender(), command.Private())
+	if !ok {
+		return []*domain.ClientMessage{
+			domain.NewClientMessage(Reply{Text("Nothing more to show")}.Render(m.renderer), command.Sender(), command.Private()),
+		}, nil
+	}
+	reply, err := next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pop()
+	return []*domain.ClientMessage{
+		domain.NewClientMessage(withMoreHint(reply, m.trigger, remaining).Render(m.renderer), command.Sender(), command.Private()),
+	}, nil
+}
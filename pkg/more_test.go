@@ -0,0 +1,44 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"net/http"
+	"testing"
+)
+
+func TestMoreCommand(t *testing.T) {
+	_, executor := newServer(t)
+	search, more := &pkg.SearchCommand{}, &pkg.MoreCommand{}
+	initCommand(t, search, executor)
+	initCommand(t, more, executor)
+	alice, bob := servicetest.NewUser("alice"), servicetest.NewUser("bob")
+	run(t, search, alice, "golang", false)
+	assertTexts(t, run(t, more, bob, "", false), "Nothing more to show")
+	assertTexts(t, run(t, more, alice, "", true), "Nothing more to show")
+	assertTexts(t, run(t, more, alice, "", false),
+		"Go by Example - https://gobyexample.com/\n"+
+			"Go by Example is a hands-on introduction to Go using annotated example programs.\n\n"+
+			"Go Packages - https://pkg.go.dev/\n"+
+			"Go is an open source programming language.\n")
+	assertTexts(t, run(t, more, alice, "", false), "Nothing more to show")
+}
+
+func TestMoreCommandKeepsPageOnFailure(t *testing.T) {
+	server, executor := newServer(t)
+	wiki, more := &pkg.WikiCommand{}, &pkg.MoreCommand{}
+	initCommand(t, wiki, executor)
+	initCommand(t, more, executor)
+	alice := servicetest.NewUser("alice")
+	run(t, wiki, alice, "golang", false)
+	server.Fail("wikipedia", http.StatusServiceUnavailable)
+	assertTexts(t, run(t, more, alice, "", false), "wikipedia is unavailable right now, please try again later")
+	server.Handle(servicetest.RecordedFixtures()...)
+	// the fixtures give the extract of the first result to every page
+	assertTexts(t, run(t, more, alice, "", false),
+		"Go (game) (https://en.wikipedia.org/wiki/Go_(programming_language))\n"+
+			"  Go is a high-level general purpose programming language that is statically typed and compiled. "+
+			"It is known for the simplicity of its syntax and the efficiency of development that it enables.\n"+
+			"  It was designed at Google in 2007 by Robert Griesemer, Rob Pike, and Ken Thompson, and publicly announced in November 2009.\n"+
+			"(1 more, use !more)")
+}
@@ -0,0 +1,177 @@
+package pkg
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var _ WeatherProvider = (*openMeteoProvider)(nil)
+
+// openMeteoDays is the number of days of the forecasts asked to Open-Meteo, today included
+const openMeteoDays = 5
+
+type openMeteoResponse struct {
+	Current struct {
+		Time                string  `json:"time"`
+		Temperature2m       float64 `json:"temperature_2m"`
+		ApparentTemperature float64 `json:"apparent_temperature"`
+		RelativeHumidity2m  float64 `json:"relative_humidity_2m"`
+		PressureMsl         float64 `json:"pressure_msl"`
+		WindSpeed10m        float64 `json:"wind_speed_10m"`
+		WindDirection10m    float64 `json:"wind_direction_10m"`
+		WindGusts10m        float64 `json:"wind_gusts_10m"`
+		Visibility          float64 `json:"visibility"`
+		CloudCover          float64 `json:"cloud_cover"`
+		WeatherCode         int     `json:"weather_code"`
+	} `json:"current"`
+	Hourly struct {
+		Time                     []string  `json:"time"`
+		Temperature2m            []float64 `json:"temperature_2m"`
+		PrecipitationProbability []float64 `json:"precipitation_probability"`
+		WeatherCode              []int     `json:"weather_code"`
+	} `json:"hourly"`
+	Daily struct {
+		Time             []string  `json:"time"`
+		WeatherCode      []int     `json:"weather_code"`
+		Temperature2mMax []float64 `json:"temperature_2m_max"`
+		Temperature2mMin []float64 `json:"temperature_2m_min"`
+		Sunrise          []string  `json:"sunrise"`
+		Sunset           []string  `json:"sunset"`
+	} `json:"daily"`
+}
+
+// weatherCodes describe the WMO weather interpretation codes used by Open-Meteo
+var weatherCodes = map[int]string{
+	0:  "clear sky",
+	1:  "mainly clear",
+	2:  "partly cloudy",
+	3:  "overcast",
+	45: "fog",
+	48: "depositing rime fog",
+	51: "light drizzle",
+	53: "moderate drizzle",
+	55: "dense drizzle",
+	56: "light freezing drizzle",
+	57: "dense freezing drizzle",
+	61: "slight rain",
+	63: "moderate rain",
+	65: "heavy rain",
+	66: "light freezing rain",
+	67: "heavy freezing rain",
+	71: "slight snow fall",
+	73: "moderate snow fall",
+	75: "heavy snow fall",
+	77: "snow grains",
+	80: "slight rain showers",
+	81: "moderate rain showers",
+	82: "violent rain showers",
+	85: "slight snow showers",
+	86: "heavy snow showers",
+	95: "thunderstorm",
+	96: "thunderstorm with slight hail",
+	99: "thunderstorm with heavy hail",
+}
+
+func describeWeatherCode(code int) string {
+	if description, ok := weatherCodes[code]; ok {
+		return description
+	}
+	return "unknown weather (code " + strconv.Itoa(code) + ")"
+}
+
+// openMeteoProvider gets forecasts from Open-Meteo, which requires no API key
+type openMeteoProvider struct {
+	client  *httpClient
+	baseUrl *url.URL
+}
+
+func (o *openMeteoProvider) Name() string {
+	return openMeteoUpstream
+}
+
+func (o *openMeteoProvider) forecastUrl(latitude float64, longitude float64) *url.URL {
+	baseUrl := endpointUrl(o.baseUrl, "v1", "forecast")
+	baseUrl.RawQuery = url.Values{
+		"latitude":        {strconv.FormatFloat(latitude, 'f', 5, 64)},
+		"longitude":       {strconv.FormatFloat(longitude, 'f', 5, 64)},
+		"current":         {"temperature_2m,apparent_temperature,relative_humidity_2m,pressure_msl,wind_speed_10m,wind_direction_10m,wind_gusts_10m,visibility,cloud_cover,weather_code"},
+		"wind_speed_unit": {"ms"},
+		"hourly":          {"temperature_2m,precipitation_probability,weather_code"},
+		"daily":           {"weather_code,temperature_2m_max,temperature_2m_min,sunrise,sunset"},
+		"timezone":        {"auto"},
+		"forecast_days":   {strconv.Itoa(openMeteoDays)},
+	}.Encode()
+	return baseUrl
+}
+
+func (o *openMeteoProvider) Forecast(ctx context.Context, latitude float64, longitude float64, now time.Time) (*Forecast, error) {
+	forecastUrl := o.forecastUrl(latitude, longitude)
+	var response openMeteoResponse
+	forecastKey := cacheKey(openMeteoUpstream, strconv.FormatFloat(latitude, 'f', 5, 64), strconv.FormatFloat(longitude, 'f', 5, 64))
+	err := cached(forecastKey, forecastCacheTTL, &response, func() error {
+		return o.client.getJSON(ctx, forecastUrl.String(), &response)
+	})
+	if err != nil {
+		return nil, upstreamError(openMeteoUpstream, err)
+	}
+	if len(response.Current.Time) == 0 {
+		return nil, notFound("No forecast available for this location")
+	}
+	current := response.Current
+	f := Forecast{Current: Conditions{
+		Temperature:   current.Temperature2m,
+		Sky:           describeWeatherCode(current.WeatherCode),
+		FeelsLike:     current.ApparentTemperature,
+		Humidity:      current.RelativeHumidity2m,
+		Clouds:        current.CloudCover,
+		Pressure:      current.PressureMsl,
+		WindSpeed:     current.WindSpeed10m,
+		WindGust:      current.WindGusts10m,
+		WindDirection: current.WindDirection10m,
+		Visibility:    current.Visibility,
+	}}
+	hourly := response.Hourly
+	for i, hour := range hourly.Time {
+		if i >= len(hourly.Temperature2m) || i >= len(hourly.PrecipitationProbability) || i >= len(hourly.WeatherCode) {
+			break
+		}
+		hourTime, err := time.ParseInLocation("2006-01-02T15:04", hour, now.Location())
+		if err != nil {
+			return nil, upstreamError(openMeteoUpstream, err)
+		}
+		f.Hours = append(f.Hours, HourForecast{
+			Time:                     hourTime,
+			Temperature:              hourly.Temperature2m[i],
+			PrecipitationProbability: hourly.PrecipitationProbability[i] / 100,
+			Sky:                      describeWeatherCode(hourly.WeatherCode[i]),
+		})
+	}
+	daily := response.Daily
+	today := atMidnight(now)
+	for i, day := range daily.Time {
+		if i >= len(daily.WeatherCode) || i >= len(daily.Temperature2mMax) || i >= len(daily.Temperature2mMin) {
+			break
+		}
+		date, err := time.ParseInLocation("2006-01-02", day, now.Location())
+		if err != nil {
+			return nil, upstreamError(openMeteoUpstream, err)
+		}
+		if !date.After(today) {
+			if date.Equal(today) && i < len(daily.Sunrise) && i < len(daily.Sunset) {
+				// at high latitudes, there may be no sunrise or sunset, which fails to parse and is left zero
+				f.Sunrise, _ = time.ParseInLocation("2006-01-02T15:04", daily.Sunrise[i], now.Location())
+				f.Sunset, _ = time.ParseInLocation("2006-01-02T15:04", daily.Sunset[i], now.Location())
+			}
+			continue
+		}
+		f.Days = append(f.Days, DayForecast{
+			Date: date,
+			Min:  daily.Temperature2mMin[i],
+			Max:  daily.Temperature2mMax[i],
+			Sky:  describeWeatherCode(daily.WeatherCode[i]),
+		})
+	}
+	return &f, nil
+}
@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ WeatherProvider = (*openWeatherProvider)(nil)
+
+type weatherResponse struct {
+	Cnt  int `json:"cnt"`
+	List []struct {
+		Dt   int64 `json:"dt"`
+		Main struct {
+			Temp      float64 `json:"temp"`
+			FeelsLike float64 `json:"feels_like"`
+			TempMin   float64 `json:"temp_min"`
+			TempMax   float64 `json:"temp_max"`
+			Pressure  int     `json:"pressure"`
+			SeaLevel  int     `json:"sea_level"`
+			GrndLevel int     `json:"grnd_level"`
+			Humidity  int     `json:"humidity"`
+			TempKf    float64 `json:"temp_kf"`
+		} `json:"main"`
+		Weather []struct {
+			Id          int    `json:"id"`
+			Main        string `json:"main"`
+			Description string `json:"description"`
+			Icon        string `json:"icon"`
+		} `json:"weather"`
+		Clouds struct {
+			All int `json:"all"`
+		} `json:"clouds"`
+		Wind struct {
+			Speed float64 `json:"speed"`
+			Deg   int     `json:"deg"`
+			Gust  float64 `json:"gust"`
+		} `json:"wind"`
+		Visibility int     `json:"visibility"`
+		Pop        float64 `json:"pop"`
+		Sys        struct {
+			Pod string `json:"pod"`
+		} `json:"sys"`
+		DtTxt string `json:"dt_txt"`
+	} `json:"list"`
+	City struct {
+		Id    int    `json:"id"`
+		Name  string `json:"name"`
+		Coord struct {
+			Lat float64 `json:"lat"`
+			Lon float64 `json:"lon"`
+		} `json:"coord"`
+		Country    string `json:"country"`
+		Population int    `json:"population"`
+		Timezone   int    `json:"timezone"`
+		Sunrise    int    `json:"sunrise"`
+		Sunset     int    `json:"sunset"`
+	} `json:"city"`
+}
+
+// kelvinToCelsius converts the temperatures of OpenWeather, given in Kelvin by default
+func kelvinToCelsius(kelvin float64) float64 {
+	return kelvin - 273.15
+}
+
+// openWeatherProvider gets forecasts from the 5 day / 3 hour forecast of OpenWeather, which requires an API key
+type openWeatherProvider struct {
+	client  *httpClient
+	baseUrl *url.URL
+	apiKey  string
+}
+
+func (o *openWeatherProvider) Name() string {
+	return openWeatherUpstream
+}
+
+func (o *openWeatherProvider) forecastUrl(latitude float64, longitude float64) *url.URL {
+	baseUrl := endpointUrl(o.baseUrl, "data", "2.5", "forecast")
+	query := baseUrl.Query()
+	query.Set("lat", strconv.FormatFloat(latitude, 'f', 5, 64))
+	query.Set("lon", strconv.FormatFloat(longitude, 'f', 5, 64))
+	query.Set("appid", o.apiKey)
+	baseUrl.RawQuery = query.Encode()
+	return baseUrl
+}
+
+func atMidnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func (o *openWeatherProvider) Forecast(ctx context.Context, latitude float64, longitude float64, now time.Time) (*Forecast, error) {
+	if len(o.apiKey) == 0 {
+		return nil, missingApiKey(openWeatherUpstream)
+	}
+	forecastUrl := o.forecastUrl(latitude, longitude)
+	var weatherResponse weatherResponse
+	forecastKey := cacheKey(openWeatherUpstream, strconv.FormatFloat(latitude, 'f', 5, 64), strconv.FormatFloat(longitude, 'f', 5, 64))
+	err := cached(forecastKey, forecastCacheTTL, &weatherResponse, func() error {
+		return o.client.getJSON(ctx, forecastUrl.String(), &weatherResponse)
+	})
+	if err != nil {
+		return nil, upstreamError(openWeatherUpstream, err)
+	}
+	if len(weatherResponse.List) == 0 || len(weatherResponse.List[0].Weather) == 0 {
+		return nil, notFound("No forecast available for this location")
+	}
+	f := Forecast{}
+	currentWeather := weatherResponse.List[0]
+	f.Current = Conditions{
+		Temperature:   kelvinToCelsius(currentWeather.Main.Temp),
+		Sky:           currentWeather.Weather[0].Description,
+		FeelsLike:     kelvinToCelsius(currentWeather.Main.FeelsLike),
+		Humidity:      float64(currentWeather.Main.Humidity),
+		Clouds:        float64(currentWeather.Clouds.All),
+		Pressure:      float64(currentWeather.Main.Pressure),
+		WindSpeed:     currentWeather.Wind.Speed,
+		WindGust:      currentWeather.Wind.Gust,
+		WindDirection: float64(currentWeather.Wind.Deg),
+		Visibility:    float64(currentWeather.Visibility),
+	}
+	if city := weatherResponse.City; city.Sunrise != 0 && city.Sunset != 0 {
+		// the location of now is the one of the time API, City.Timezone only being an UTC offset
+		f.Sunrise = time.Unix(int64(city.Sunrise), 0).In(now.Location())
+		f.Sunset = time.Unix(int64(city.Sunset), 0).In(now.Location())
+	}
+	nextDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	for _, ww := range weatherResponse.List {
+		if len(ww.Weather) == 0 {
+			continue
+		}
+		f.Hours = append(f.Hours, HourForecast{
+			Time:                     time.Unix(ww.Dt, 0).In(now.Location()),
+			Temperature:              kelvinToCelsius(ww.Main.Temp),
+			PrecipitationProbability: ww.Pop,
+			Sky:                      ww.Weather[0].Description,
+		})
+		if len(f.Days) == 0 && ww.Dt < nextDay.Unix() {
+			continue
+		}
+		forecastDay := atMidnight(time.Unix(ww.Dt, 0).In(now.Location()))
+		if forecastDay.Unix() == nextDay.Unix() {
+			f.Days = append(f.Days, DayForecast{Date: nextDay, Min: math.MaxFloat64, Max: -math.MaxFloat64})
+			nextDay = time.Date(nextDay.Year(), nextDay.Month(), nextDay.Day()+1, 0, 0, 0, 0, nextDay.Location())
+		}
+		followingDay := &f.Days[len(f.Days)-1]
+		followingDay.Min = math.Min(followingDay.Min, kelvinToCelsius(ww.Main.TempMin))
+		followingDay.Max = math.Max(followingDay.Max, kelvinToCelsius(ww.Main.TempMax))
+		if !strings.HasSuffix(followingDay.Sky, ww.Weather[0].Description) {
+			if followingDay.Sky != "" {
+				followingDay.Sky += " - "
+			}
+			followingDay.Sky += ww.Weather[0].Description
+		}
+	}
+	if len(f.Days) > 0 {
+		// the forecast ends in the course of the last day
+		f.Days = f.Days[:len(f.Days)-1]
+	}
+	return &f, nil
+}
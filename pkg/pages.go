@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/raf924/connector-sdk/domain"
+	"sync"
+	"time"
+)
+
+// pagesTTL is how long the pages of a result remain available
+const pagesTTL = 10 * time.Minute
+
+// page loads one page of a paginated result, which lets costly pages be fetched only when asked for
+type page func(ctx context.Context) (Reply, error)
+
+func staticPage(reply Reply) page {
+	return func(context.Context) (Reply, error) {
+		return reply, nil
+	}
+}
+
+// chunk groups results in replies of at most size results each
+func chunk(results []Reply, size int) []Reply {
+	var chunks []Reply
+	for start := 0; start < len(results); start += size {
+		end := start + size
+		if end > len(results) {
+			end = len(results)
+		}
+		var reply Reply
+		for _, result := range results[start:end] {
+			reply = append(reply, result...)
+		}
+		chunks = append(chunks, reply)
+	}
+	return chunks
+}
+
+func staticPages(replies []Reply) []page {
+	pages := make([]page, len(replies))
+	for i, reply := range replies {
+		pages[i] = staticPage(reply)
+	}
+	return pages
+}
+
+type pendingPages struct {
+	pages []page
+	// shown counts the pages shown so far, telling whether a page being loaded is still the next one
+	shown int
+	// upstreams are the ones the pages may call when loaded
+	upstreams []string
+	expiresAt time.Time
+}
+
+// pageStore remembers, for each user of each channel, the pages of their last paginated result they have not seen yet
+type pageStore struct {
+	m       sync.Mutex
+	pending map[string]*pendingPages
+}
+
+var paginatedResults = &pageStore{pending: map[string]*pendingPages{}}
+
+func pagesKey(user *domain.User, private bool) string {
+	return userKey(user) + "@" + channelOf(user, private)
+}
+
+// set replaces the pages remembered for user with the given ones, which may call upstreams when loaded
+func (p *pageStore) set(user *domain.User, private bool, pages []page, upstreams []string) {
+	key := pagesKey(user, private)
+	now := time.Now()
+	p.m.Lock()
+	defer p.m.Unlock()
+	for k, pending := range p.pending {
+		if now.After(pending.expiresAt) {
+			delete(p.pending, k)
+		}
+	}
+	if len(pages) == 0 {
+		delete(p.pending, key)
+		return
+	}
+	p.pending[key] = &pendingPages{pages: pages, upstreams: upstreams, expiresAt: now.Add(pagesTTL)}
+}
+
+// next returns the next page remembered for user and how many are left after it, without forgetting it:
+// the returned function does, once the page is loaded, so that a page failing to load can be asked for again
+func (p *pageStore) next(user *domain.User, private bool) (page, int, func(), bool) {
+	key := pagesKey(user, private)
+	p.m.Lock()
+	defer p.m.Unlock()
+	pending, ok := p.pending[key]
+	if !ok || time.Now().After(pending.expiresAt) {
+		delete(p.pending, key)
+		return nil, 0, nil, false
+	}
+	shown := pending.shown
+	pop := func() {
+		p.m.Lock()
+		defer p.m.Unlock()
+		if p.pending[key] != pending || pending.shown != shown {
+			// replaced by another result, or shown by a concurrent invocation
+			return
+		}
+		pending.pages = pending.pages[1:]
+		pending.shown++
+		if len(pending.pages) == 0 {
+			delete(p.pending, key)
+		}
+	}
+	return pending.pages[0], len(pending.pages) - 1, pop, true
+}
+
+// upstreams returns the upstreams the pages remembered for user may call
+func (p *pageStore) upstreams(user *domain.User, private bool) []string {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if pending, ok := p.pending[pagesKey(user, private)]; ok {
+		return pending.upstreams
+	}
+	return nil
+}
+
+// paginate remembers the pages following the first one for the sender of command, which may call upstreams when loaded,
+// and returns the first one with a hint about the others
+func paginate(command *domain.CommandMessage, trigger string, first Reply, others []page, upstreams ...string) Reply {
+	paginatedResults.set(command.Sender(), command.Private(), others, upstreams)
+	return withMoreHint(first, trigger, len(others))
+}
+
+func withMoreHint(reply Reply, trigger string, remaining int) Reply {
+	if remaining == 0 {
+		return reply
+	}
+	return append(reply, Text(fmt.Sprintf("(%d more, use %smore)", remaining, trigger)))
+}
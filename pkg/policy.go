@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/raf924/connector-sdk/domain"
+	"strings"
+	"sync"
+)
+
+// channelPoliciesKey is the ApiKeys entry holding the channel policies as a JSON object, keyed by channel
+const channelPoliciesKey = "channel_policies"
+
+// Channels a ChannelPolicy can be set for, on top of a single private conversation ("private:" followed by the id of the user)
+const (
+	PublicChannel   = "public"
+	PrivateChannels = "private"
+	AnyChannel      = "*"
+)
+
+// ChannelPolicy tells which commands can be used in a channel and how they behave there
+type ChannelPolicy struct {
+	// Disabled lists the commands which cannot be used, by name to disable a command with all its aliases or by alias
+	Disabled []string `json:"disabled,omitempty"`
+	// DisablePassive stops the commands acting upon chat messages, such as youtube
+	DisablePassive bool `json:"disable_passive,omitempty"`
+	// Settings override the defaults of the commands, e.g. "safesearch", "locale" or "units"
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+func (c ChannelPolicy) allows(name string, alias string, passive bool) bool {
+	if passive && c.DisablePassive {
+		return false
+	}
+	for _, disabled := range c.Disabled {
+		if strings.EqualFold(disabled, name) || (len(alias) > 0 && strings.EqualFold(disabled, alias)) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	policiesLock    sync.RWMutex
+	channelPolicies = map[string]ChannelPolicy{}
+)
+
+// SetChannelPolicies replaces the policies of the channels, keyed by PublicChannel, PrivateChannels, AnyChannel
+// or a single private conversation. Each channel gets the first policy found among its own, the one of private
+// conversations if it is one, and the one of AnyChannel.
+func SetChannelPolicies(policies map[string]ChannelPolicy) {
+	copied := make(map[string]ChannelPolicy, len(policies))
+	for channel, policy := range policies {
+		copied[strings.ToLower(channel)] = policy
+	}
+	policiesLock.Lock()
+	channelPolicies = copied
+	policiesLock.Unlock()
+}
+
+func parseChannelPolicies(rawPolicies string) (map[string]ChannelPolicy, error) {
+	var policies map[string]ChannelPolicy
+	if err := json.Unmarshal([]byte(rawPolicies), &policies); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", channelPoliciesKey, err)
+	}
+	return policies, nil
+}
+
+// policyOf returns the policy of the channel a message of sender was sent to
+func policyOf(sender *domain.User, private bool) ChannelPolicy {
+	candidates := []string{strings.ToLower(channelOf(sender, private))}
+	if private {
+		candidates = append(candidates, PrivateChannels)
+	}
+	candidates = append(candidates, AnyChannel)
+	policiesLock.RLock()
+	defer policiesLock.RUnlock()
+	for _, channel := range candidates {
+		if policy, ok := channelPolicies[channel]; ok {
+			return policy
+		}
+	}
+	return ChannelPolicy{}
+}
+
+type settingsKey struct{}
+
+// setting returns the value the channel of the invocation ctx belongs to sets for key, or fallback
+func setting(ctx context.Context, key string, fallback string) string {
+	settings, _ := ctx.Value(settingsKey{}).(map[string]string)
+	if value, ok := settings[key]; ok && len(value) > 0 {
+		return value
+	}
+	return fallback
+}
+
+// applyPolicy drops the invocations of commands disabled in their channel and hands the others its settings
+func applyPolicy(next handler) handler {
+	return func(inv *invocation) ([]*domain.ClientMessage, error) {
+		policy := policyOf(inv.sender, inv.private)
+		if !policy.allows(inv.command.Name(), inv.alias, inv.passive) {
+			inv.logger.Info("invocation disabled by channel policy")
+			if inv.passive {
+				return nil, nil
+			}
+			name := inv.alias
+			if len(name) == 0 {
+				name = inv.command.Name()
+			}
+			return []*domain.ClientMessage{
+				domain.NewClientMessage(fmt.Sprintf("%s is disabled here", name), inv.sender, inv.private),
+			}, nil
+		}
+		if len(policy.Settings) > 0 {
+			inv.ctx = context.WithValue(inv.ctx, settingsKey{}, policy.Settings)
+		}
+		return next(inv)
+	}
+}
@@ -0,0 +1,56 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"testing"
+)
+
+// setChannelPolicies sets policies for the rest of the test
+func setChannelPolicies(t *testing.T, policies map[string]pkg.ChannelPolicy) {
+	t.Helper()
+	pkg.SetChannelPolicies(policies)
+	t.Cleanup(func() { pkg.SetChannelPolicies(nil) })
+}
+
+func TestChannelPolicyDisables(t *testing.T) {
+	_, executor := newServer(t)
+	setChannelPolicies(t, map[string]pkg.ChannelPolicy{pkg.PublicChannel: {Disabled: []string{"u"}, DisablePassive: true}})
+	urban, youtube := &pkg.UrbanCommand{}, &pkg.YoutubeCommand{}
+	initCommand(t, urban, executor)
+	initCommand(t, youtube, executor)
+	alice := servicetest.NewUser("alice")
+	messages, err := urban.Execute(servicetest.NewCommandMessage(alice, "u", "yeet", false))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	assertTexts(t, servicetest.Texts(messages), "u is disabled here")
+	if texts := run(t, urban, alice, "yeet", false); len(texts) != 1 || texts[0] == "urban is disabled here" {
+		t.Errorf("texts = %q, want urban still usable by its name", texts)
+	}
+	messages, err = youtube.OnChat(servicetest.NewChatMessage(alice, "https://youtu.be/dQw4w9WgXcQ", false))
+	if err != nil || len(messages) != 0 {
+		t.Errorf("OnChat() = %q, %v, want nothing in the public channel", servicetest.Texts(messages), err)
+	}
+	messages, _ = youtube.OnChat(servicetest.NewChatMessage(alice, "https://youtu.be/dQw4w9WgXcQ", true))
+	if len(messages) != 1 {
+		t.Errorf("OnChat() = %q, want the video in private", servicetest.Texts(messages))
+	}
+}
+
+func TestChannelPolicySettings(t *testing.T) {
+	server, executor := newServer(t)
+	setChannelPolicies(t, map[string]pkg.ChannelPolicy{
+		pkg.PrivateChannels: {Settings: map[string]string{"safesearch": "0"}},
+		pkg.AnyChannel:      {Settings: map[string]string{"safesearch": "2"}},
+	})
+	search := &pkg.SearchCommand{}
+	initCommand(t, search, executor)
+	alice := servicetest.NewUser("alice")
+	run(t, search, alice, "golang", true)
+	run(t, search, alice, "rust", false)
+	requests := server.Requests("qwant")
+	if len(requests) != 2 || requests[0].Query().Get("safesearch") != "0" || requests[1].Query().Get("safesearch") != "2" {
+		t.Errorf("qwant requests = %v, want safesearch 0 in private and 2 elsewhere", requests)
+	}
+}
@@ -0,0 +1,292 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/raf924/connector-sdk/command"
+	"github.com/raf924/connector-sdk/domain"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var _ command.Command = (*PreferencesCommand)(nil)
+var _ Helper = (*PreferencesCommand)(nil)
+var _ ContextExecutable = (*PreferencesCommand)(nil)
+
+// preferencesFileKey is the ApiKeys entry naming the file the preferences of users are persisted to
+const preferencesFileKey = "preferences_file"
+
+// Preferences are the defaults a user chose for the arguments they omit
+type Preferences struct {
+	// Location is the city of weather and time
+	Location string `json:"location,omitempty"`
+	// Units are the units of weather, metric or imperial
+	Units string `json:"units,omitempty"`
+	// Lang is the language of dictionary and wiki
+	Lang string `json:"lang,omitempty"`
+	// Locale is the locale of search results, e.g. "fr" or "fr-CA"
+	Locale string `json:"locale,omitempty"`
+}
+
+var languagePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z]{2})?$`)
+
+// preference describes a field of Preferences to the prefs command
+type preference struct {
+	name        string
+	description string
+	choices     []string
+	pattern     *regexp.Regexp
+	field       func(p *Preferences) *string
+}
+
+var preferences = []preference{
+	{
+		name:        "location",
+		description: "city of weather and time",
+		field:       func(p *Preferences) *string { return &p.Location },
+	},
+	{
+		name:        "units",
+		description: "units of weather",
+		choices:     []string{"metric", "imperial"},
+		field:       func(p *Preferences) *string { return &p.Units },
+	},
+	{
+		name:        "lang",
+		description: "language of dictionary and wiki, e.g. fr",
+		pattern:     languagePattern,
+		field:       func(p *Preferences) *string { return &p.Lang },
+	},
+	{
+		name:        "locale",
+		description: "locale of search, e.g. fr or fr-CA",
+		pattern:     languagePattern,
+		field:       func(p *Preferences) *string { return &p.Locale },
+	},
+}
+
+func preferenceNames() []string {
+	names := make([]string, len(preferences))
+	for i, preference := range preferences {
+		names[i] = preference.name
+	}
+	return names
+}
+
+func findPreference(name string) (preference, bool) {
+	for _, p := range preferences {
+		if strings.EqualFold(p.name, name) {
+			return p, true
+		}
+	}
+	return preference{}, false
+}
+
+func (p preference) validate(value string) (string, error) {
+	if len(p.choices) > 0 {
+		for _, choice := range p.choices {
+			if strings.EqualFold(choice, value) {
+				return choice, nil
+			}
+		}
+		return "", badInput("%s must be one of %s", p.name, strings.Join(p.choices, ", "))
+	}
+	if p.pattern != nil && !p.pattern.MatchString(value) {
+		return "", badInput("%q is not a valid %s, expected a %s", value, p.name, p.description)
+	}
+	return value, nil
+}
+
+// preferencesStore keeps the preferences of every user, persisting them if it has a file
+type preferencesStore struct {
+	m     sync.RWMutex
+	users map[string]Preferences
+	// filename is empty unless the preferences are persisted
+	filename string
+}
+
+var userPreferences = &preferencesStore{users: map[string]Preferences{}}
+
+func (s *preferencesStore) get(user *domain.User) Preferences {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.users[userKey(user)]
+}
+
+// update applies change to the preferences of user and returns them
+func (s *preferencesStore) update(user *domain.User, change func(p *Preferences)) Preferences {
+	s.m.Lock()
+	defer s.m.Unlock()
+	key := userKey(user)
+	p := s.users[key]
+	change(&p)
+	if p == (Preferences{}) {
+		delete(s.users, key)
+	} else {
+		s.users[key] = p
+	}
+	if len(s.filename) > 0 {
+		if err := s.save(); err != nil {
+			currentLogger().Error("cannot save preferences", "filename", s.filename, "err", err)
+		}
+	}
+	return p
+}
+
+// save writes the preferences to their file at once, unlike storage.Storage whose asynchronous saves
+// may land out of order, since losing preferences would be noticed, unlike losing cached responses
+func (s *preferencesStore) save() error {
+	content, err := json.Marshal(s.users)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(s.filename, content)
+}
+
+// writeFileAtomically replaces the content of filename, which is left untouched if writing fails
+func writeFileAtomically(filename string, content []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+	}
+	return err
+}
+
+// SetPreferencesFile persists the preferences of users to filename, loading the ones it already holds
+func SetPreferencesFile(filename string) error {
+	users := map[string]Preferences{}
+	content, err := ioutil.ReadFile(filename)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(content, &users); err != nil {
+			return fmt.Errorf("invalid preferences file %s: %w", filename, err)
+		}
+	}
+	userPreferences.m.Lock()
+	userPreferences.users = users
+	userPreferences.filename = filename
+	userPreferences.m.Unlock()
+	return nil
+}
+
+// preferencesOf returns the preferences of user
+func preferencesOf(user *domain.User) Preferences {
+	return userPreferences.get(user)
+}
+
+// PreferencesCommand shows and sets the preferences of its sender
+type PreferencesCommand struct {
+	command.NoOpInterceptor
+	trigger  string
+	renderer Renderer
+}
+
+func (p *PreferencesCommand) Init(executor command.Executor) error {
+	if err := setUp(executor); err != nil {
+		return err
+	}
+	var err error
+	p.trigger = executor.Trigger()
+	p.renderer, err = rendererFor(executor)
+	return err
+}
+
+func (p *PreferencesCommand) Name() string {
+	return "set"
+}
+
+func (p *PreferencesCommand) Aliases() []string {
+	return []string{"prefs", "unset"}
+}
+
+func (p *PreferencesCommand) Usage() string {
+	return "[" + strings.Join(preferenceNames(), "|") + " <value>]"
+}
+
+func (p *PreferencesCommand) Description() string {
+	return fmt.Sprintf("Shows your preferences, or sets the defaults of the arguments you omit (%sunset <preference> to clear one)", p.trigger)
+}
+
+func (p *PreferencesCommand) Examples() []string {
+	return []string{"", "location \"new york\"", "units imperial", "lang fr"}
+}
+
+func (p *PreferencesCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	return execute(p, command)
+}
+
+func (p *PreferencesCommand) ExecuteContext(_ context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	args, err := parseArgs(command.ArgString())
+	if err != nil {
+		return nil, err
+	}
+	var reply Reply
+	switch {
+	case len(args.positional) == 0:
+		reply = p.show(preferencesOf(command.Sender()))
+	case strings.EqualFold(command.Command(), "unset"):
+		preference, ok := findPreference(args.positional[0])
+		if !ok {
+			return nil, badInput("Unknown preference %q, expected one of %s", args.positional[0], strings.Join(preferenceNames(), ", "))
+		}
+		userPreferences.update(command.Sender(), func(prefs *Preferences) {
+			*preference.field(prefs) = ""
+		})
+		reply = Reply{Text(fmt.Sprintf("Cleared %s", preference.name))}
+	default:
+		preference, ok := findPreference(args.positional[0])
+		if !ok {
+			return nil, badInput("Unknown preference %q, expected one of %s", args.positional[0], strings.Join(preferenceNames(), ", "))
+		}
+		if len(args.positional) == 1 {
+			prefs := preferencesOf(command.Sender())
+			value := *preference.field(&prefs)
+			if len(value) == 0 {
+				value = "not set"
+			}
+			reply = Reply{Field{Name: preference.name, Value: value}}
+			break
+		}
+		value, err := preference.validate(strings.Join(args.positional[1:], " "))
+		if err != nil {
+			return nil, err
+		}
+		userPreferences.update(command.Sender(), func(prefs *Preferences) {
+			*preference.field(prefs) = value
+		})
+		reply = Reply{Text(fmt.Sprintf("Saved %s: %s", preference.name, value))}
+	}
+	return []*domain.ClientMessage{
+		domain.NewClientMessage(reply.Render(p.renderer), command.Sender(), command.Private()),
+	}, nil
+}
+
+func (p *PreferencesCommand) show(prefs Preferences) Reply {
+	reply := Reply{Heading("Your preferences")}
+	for _, preference := range preferences {
+		value := *preference.field(&prefs)
+		if len(value) == 0 {
+			value = "not set"
+		}
+		reply = append(reply, Field{Name: preference.name, Value: value})
+	}
+	return append(reply, Text(fmt.Sprintf("Use %s%s <preference> <value> to change them", p.trigger, p.Name())))
+}
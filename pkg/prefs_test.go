@@ -0,0 +1,72 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"strings"
+	"testing"
+)
+
+func TestPreferencesCommand(t *testing.T) {
+	_, executor := newServer(t)
+	set := &pkg.PreferencesCommand{}
+	initCommand(t, set, executor)
+	alice := servicetest.NewUser("alice")
+	assertTexts(t, run(t, set, alice, "", false),
+		"Your preferences:\nlocation: not set\nunits: not set\nlang: not set\nlocale: not set\nUse !set <preference> <value> to change them")
+	assertTexts(t, run(t, set, alice, "location \"new york\"", false), "Saved location: new york")
+	assertTexts(t, run(t, set, alice, "units imperial", false), "Saved units: imperial")
+	assertTexts(t, run(t, set, alice, "units", false), "units: imperial")
+	assertTexts(t, run(t, set, alice, "units kelvin", false), "units must be one of metric, imperial")
+	assertTexts(t, run(t, set, alice, "color blue", false), "Unknown preference \"color\", expected one of location, units, lang, locale")
+	assertTexts(t, run(t, set, servicetest.NewUser("bob"), "units", false), "units: not set")
+
+	messages, err := set.Execute(servicetest.NewCommandMessage(alice, "unset", "units", false))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	assertTexts(t, servicetest.Texts(messages), "Cleared units")
+	assertTexts(t, run(t, set, alice, "units", false), "units: not set")
+}
+
+func TestPreferencesCommandDefaults(t *testing.T) {
+	server, executor := newServer(t)
+	set, weather := &pkg.PreferencesCommand{}, &pkg.WeatherCommand{}
+	initCommand(t, set, executor)
+	initCommand(t, weather, executor)
+	alice := servicetest.NewUser("alice")
+	run(t, set, alice, "location lyon", false)
+	run(t, set, alice, "units imperial", false)
+	texts := run(t, weather, alice, "", false)
+	if len(texts) != 1 || !strings.HasPrefix(texts[0], "Showing weather for Paris, France\nCurrent: 53.3°F - clear sky\n") {
+		t.Errorf("texts = %q, want the weather in Fahrenheit", texts)
+	}
+	if requests := server.Requests("geocoding"); len(requests) != 1 || requests[0].Query().Get("q") != "lyon" {
+		t.Errorf("geocoding requests = %v, want lyon searched once", requests)
+	}
+}
+
+func TestPreferencesCommandDefaultLocationWithShorthands(t *testing.T) {
+	server, executor := newServer(t)
+	set, weather := &pkg.PreferencesCommand{}, &pkg.WeatherCommand{}
+	initCommand(t, set, executor)
+	initCommand(t, weather, executor)
+	alice := servicetest.NewUser("alice")
+	assertTexts(t, run(t, weather, alice, "f", false), "Which city? e.g. weather paris f, or set a default one with !set location paris")
+	run(t, set, alice, "location lyon", false)
+	if texts := run(t, weather, alice, "f", false); len(texts) != 1 || !strings.HasPrefix(texts[0], "Showing weather for Paris, France\nCurrent: 53.3°F - clear sky\n") {
+		t.Errorf("texts = %q, want the weather of the saved location in Fahrenheit", texts)
+	}
+	if texts := run(t, weather, alice, "12h", false); len(texts) != 1 || !strings.HasPrefix(texts[0], "Showing the weather of the next 12h for Paris, France\n") {
+		t.Errorf("texts = %q, want the hourly forecast of the saved location", texts)
+	}
+	requests := server.Requests("geocoding")
+	if len(requests) == 0 {
+		t.Errorf("geocoding requests = none, want the saved location searched")
+	}
+	for _, request := range requests {
+		if q := request.Query().Get("q"); q != "lyon" {
+			t.Errorf("geocoding query = %s, want the saved location rather than a shorthand", q)
+		}
+	}
+}
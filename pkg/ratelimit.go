@@ -0,0 +1,192 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/raf924/connector-sdk/domain"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit allows Burst calls at once then PerMinute calls every minute
+type RateLimit struct {
+	PerMinute float64 `json:"per_minute"`
+	Burst     float64 `json:"burst"`
+}
+
+var (
+	defaultUserLimit     = RateLimit{PerMinute: 6, Burst: 3}
+	defaultChannelLimit  = RateLimit{PerMinute: 20, Burst: 10}
+	defaultUpstreamLimit = RateLimit{PerMinute: 60, Burst: 20}
+)
+
+// defaultUpstreamLimits protect the quotas of the upstreams that have one
+var defaultUpstreamLimits = map[string]RateLimit{
+	qwantUpstream:       {PerMinute: 30, Burst: 10},
+	openWeatherUpstream: {PerMinute: 50, Burst: 20},
+	geocodingUpstream:   {PerMinute: 60, Burst: 10},
+	youtubeApiUpstream:  {PerMinute: 60, Burst: 20},
+}
+
+var (
+	rateLimitsLock sync.RWMutex
+	rateLimits     = DefaultConfig().RateLimits
+)
+
+// setRateLimits replaces the limits of the invocations to come, buckets keeping the tokens they hold
+func setRateLimits(limits RateLimitsConfig) {
+	rateLimitsLock.Lock()
+	rateLimits = limits
+	rateLimitsLock.Unlock()
+}
+
+// upstreamUser is implemented by commands to tell which upstreams their invocations reach
+type upstreamUser interface {
+	upstreams() []string
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.limit.Burst, b.tokens+now.Sub(b.last).Minutes()*b.limit.PerMinute)
+	b.last = now
+}
+
+// wait returns how long until the bucket holds a token
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	if b.limit.PerMinute <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((1 - b.tokens) / b.limit.PerMinute * float64(time.Minute))
+}
+
+type rateLimiter struct {
+	m       sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+var limiter = &rateLimiter{buckets: map[string]*tokenBucket{}}
+
+// maxIdleBuckets is the number of buckets above which full buckets, being equivalent to missing ones, are dropped
+const maxIdleBuckets = 1024
+
+// take consumes a token from each of the buckets if they all hold one,
+// otherwise it consumes nothing and returns how long to wait before trying again
+func (r *rateLimiter) take(limits map[string]RateLimit) (bool, time.Duration) {
+	now := time.Now()
+	r.m.Lock()
+	defer r.m.Unlock()
+	if len(r.buckets) > maxIdleBuckets {
+		for key, bucket := range r.buckets {
+			if bucket.refill(now); bucket.tokens >= bucket.limit.Burst {
+				delete(r.buckets, key)
+			}
+		}
+	}
+	var wait time.Duration
+	buckets := make([]*tokenBucket, 0, len(limits))
+	for key, l := range limits {
+		bucket, ok := r.buckets[key]
+		if !ok {
+			bucket = &tokenBucket{tokens: l.Burst, last: now}
+			r.buckets[key] = bucket
+		}
+		bucket.limit = l
+		bucket.refill(now)
+		if w := bucket.wait(); w > wait {
+			wait = w
+		}
+		buckets = append(buckets, bucket)
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return true, 0
+}
+
+// channelOf identifies where a message was sent.
+// The connector sdk has no notion of channels beyond private conversations,
+// so each private conversation is a channel of its own and every other message belongs to the public one.
+func channelOf(sender *domain.User, private bool) string {
+	if private {
+		return "private:" + userKey(sender)
+	}
+	return "public"
+}
+
+// invocationUpstreamUser is implemented by the commands whose upstreams depend on the invocation, e.g. more
+type invocationUpstreamUser interface {
+	invocationUpstreams(inv *invocation) []string
+}
+
+func invocationLimits(inv *invocation) map[string]RateLimit {
+	rateLimitsLock.RLock()
+	defer rateLimitsLock.RUnlock()
+	limits := map[string]RateLimit{
+		"user:" + userKey(inv.sender):                   rateLimits.User,
+		"channel:" + channelOf(inv.sender, inv.private): rateLimits.Channel,
+	}
+	var upstreams []string
+	if user, ok := inv.command.(upstreamUser); ok {
+		upstreams = user.upstreams()
+	}
+	if user, ok := inv.command.(invocationUpstreamUser); ok {
+		upstreams = user.invocationUpstreams(inv)
+	}
+	addUpstreamLimits(limits, upstreams)
+	return limits
+}
+
+// upstreamLimits are the limits of calls to upstreams made outside of invocations, which share their buckets
+func upstreamLimits(upstreams []string) map[string]RateLimit {
+	rateLimitsLock.RLock()
+	defer rateLimitsLock.RUnlock()
+	limits := map[string]RateLimit{}
+	addUpstreamLimits(limits, upstreams)
+	return limits
+}
+
+// addUpstreamLimits must be called with rateLimitsLock held
+func addUpstreamLimits(limits map[string]RateLimit, upstreams []string) {
+	for _, upstream := range upstreams {
+		l, ok := rateLimits.Upstreams[upstream]
+		if !ok {
+			l = rateLimits.Upstream
+		}
+		limits["upstream:"+upstream] = l
+	}
+}
+
+// rateLimit rejects invocations once their sender, their channel or one of their upstreams has been solicited too much
+func rateLimit(next handler) handler {
+	return func(inv *invocation) ([]*domain.ClientMessage, error) {
+		allowed, wait := limiter.take(invocationLimits(inv))
+		if allowed {
+			return next(inv)
+		}
+		rateLimitedTotal.inc(inv.command.Name())
+		inv.logger.Info("invocation rate limited", "wait", wait)
+		if inv.passive {
+			// answering every chat message that would have triggered a command would be spam in itself
+			return nil, nil
+		}
+		seconds := int(math.Ceil(wait.Seconds()))
+		return []*domain.ClientMessage{
+			domain.NewClientMessage(
+				fmt.Sprintf("Slow down please, %s can be used again in %ds", inv.command.Name(), seconds),
+				inv.sender,
+				inv.private,
+			),
+		}, nil
+	}
+}
@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"github.com/raf924/connector-sdk/domain"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	limiter := &rateLimiter{buckets: map[string]*tokenBucket{}}
+	limits := map[string]RateLimit{"user:alice": {PerMinute: 6, Burst: 2}}
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.take(limits); !allowed {
+			t.Fatalf("take() #%d refused, want the burst allowed", i+1)
+		}
+	}
+	allowed, wait := limiter.take(limits)
+	if allowed || wait <= 9*time.Second || wait > 10*time.Second {
+		t.Errorf("take() = %v, %s, want refused for up to 10s", allowed, wait)
+	}
+	limiter.buckets["user:alice"].last = time.Now().Add(-10 * time.Second)
+	if allowed, _ := limiter.take(limits); !allowed {
+		t.Errorf("take() refused 10s later, want a token refilled")
+	}
+}
+
+func TestRateLimiterTakesFromAllBucketsOrNone(t *testing.T) {
+	limiter := &rateLimiter{buckets: map[string]*tokenBucket{}}
+	limiter.take(map[string]RateLimit{"channel:public": {PerMinute: 1, Burst: 1}})
+	limits := map[string]RateLimit{"user:alice": {PerMinute: 1, Burst: 1}, "channel:public": {PerMinute: 1, Burst: 1}}
+	if allowed, _ := limiter.take(limits); allowed {
+		t.Fatalf("take() allowed, want refused as the channel has no token left")
+	}
+	if tokens := limiter.buckets["user:alice"].tokens; tokens != 1 {
+		t.Errorf("user tokens = %v, want the refused invocation to consume none", tokens)
+	}
+}
+
+func TestChannelOf(t *testing.T) {
+	alice := domain.NewUser("alice", "1", domain.RegularUser)
+	if channel := channelOf(alice, false); channel != "public" {
+		t.Errorf("channelOf(public) = %s, want public", channel)
+	}
+	if channel := channelOf(alice, true); channel != "private:1" {
+		t.Errorf("channelOf(private) = %s, want the private conversation of alice", channel)
+	}
+}
@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// configPollInterval is how often the configuration file is checked for changes
+const configPollInterval = 5 * time.Second
+
+var (
+	// executorPolicies are the channel policies given by the executor, standing in for the Channels of the Config
+	executorPolicies map[string]ChannelPolicy
+	// configFile is the configuration file named by the executor, if any
+	configFile   string
+	configFileMu sync.Mutex
+)
+
+// loadConfig loads the configuration file filename and applies it
+func loadConfig(filename string) error {
+	config, err := LoadConfig(filename)
+	if err != nil {
+		return err
+	}
+	if len(config.Channels) == 0 {
+		config.Channels = executorPolicies
+	}
+	return SetConfig(config)
+}
+
+// ReloadConfig reloads the configuration file named by the executor, and the environment variables, and applies them.
+// The configuration file is already reloaded whenever it changes; hosts can also call ReloadConfig, or ReloadOnHangUp.
+// An invalid configuration is returned as an error, the commands keeping the previous one.
+func ReloadConfig() error {
+	configFileMu.Lock()
+	filename := configFile
+	configFileMu.Unlock()
+	logger := currentLogger().With("filename", filename)
+	if err := loadConfig(filename); err != nil {
+		logger.Error("cannot reload configuration, keeping the previous one", "err", err)
+		return err
+	}
+	logger.Info("configuration reloaded")
+	return nil
+}
+
+// watchConfig reloads the configuration file filename whenever it changes, until Shutdown.
+// An invalid configuration is logged and ignored, the commands keeping the previous one.
+func watchConfig(filename string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	logger := currentLogger().With("filename", filename)
+	lastInfo, _ := os.Stat(filename)
+	for {
+		select {
+		case <-rootContext.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(filename)
+		if err != nil || (lastInfo != nil && info.ModTime().Equal(lastInfo.ModTime()) && info.Size() == lastInfo.Size()) {
+			continue
+		}
+		lastInfo = info
+		logger.Info("reloading configuration", "trigger", "change")
+		if err := loadConfig(filename); err != nil {
+			logger.Error("cannot reload configuration, keeping the previous one", "err", err)
+			continue
+		}
+		logger.Info("configuration reloaded")
+	}
+}
+
+// ReloadOnHangUp has the configuration reloaded whenever the process receives SIGHUP, until Shutdown.
+// It is up to hosts to call it, as the signal may already mean something else to them.
+func ReloadOnHangUp() {
+	hangUps := make(chan os.Signal, 1)
+	signal.Notify(hangUps, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangUps)
+		reloadOn(hangUps)
+	}()
+}
+
+// reloadOn reloads the configuration whenever signals receives one, until Shutdown
+func reloadOn(signals <-chan os.Signal) {
+	for {
+		select {
+		case <-rootContext.Done():
+			return
+		case received := <-signals:
+			currentLogger().Info("reloading configuration", "trigger", received.String())
+			_ = ReloadConfig()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// useConfigFile makes filename the configuration file named by the executor for the rest of the test,
+// writing the current Config changed by change to it
+func useConfigFile(t *testing.T, change func(config *Config)) string {
+	t.Helper()
+	configLock.RLock()
+	previous := currentConfig
+	configLock.RUnlock()
+	configFileMu.Lock()
+	previousFile := configFile
+	filename := filepath.Join(t.TempDir(), "config.json")
+	configFile = filename
+	configFileMu.Unlock()
+	t.Cleanup(func() {
+		configFileMu.Lock()
+		configFile = previousFile
+		configFileMu.Unlock()
+		_ = SetConfig(previous)
+	})
+	config := previous
+	change(&config)
+	writeConfigFile(t, filename, config)
+	return filename
+}
+
+func writeConfigFile(t *testing.T, filename string, config Config) {
+	t.Helper()
+	content, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if err := ioutil.WriteFile(filename, content, 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+// waitForResults waits for the search results of the current Config to be results
+func waitForResults(t *testing.T, results int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		configLock.RLock()
+		current := currentConfig.Search.Results
+		configLock.RUnlock()
+		if current == results {
+			return
+		}
+	}
+	t.Fatalf("search results never became %d", results)
+}
+
+func TestReloadConfig(t *testing.T) {
+	filename := useConfigFile(t, func(config *Config) { config.Search.Results = 3 })
+	if err := ReloadConfig(); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+	waitForResults(t, 3)
+	if err := ioutil.WriteFile(filename, []byte(`{"search": {"results": 50}}`), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := ReloadConfig(); err == nil {
+		t.Errorf("ReloadConfig() error = nil, want the invalid configuration rejected")
+	}
+	waitForResults(t, 3)
+}
+
+func TestReloadOnSignal(t *testing.T) {
+	useConfigFile(t, func(config *Config) { config.Search.Results = 4 })
+	signals := make(chan os.Signal, 1)
+	go reloadOn(signals)
+	signals <- syscall.SIGHUP
+	waitForResults(t, 4)
+}
+
+func TestWatchConfig(t *testing.T) {
+	filename := useConfigFile(t, func(config *Config) { config.Search.Results = 5 })
+	go watchConfig(filename, 10*time.Millisecond)
+	// the watcher first looks at the file as it is
+	time.Sleep(50 * time.Millisecond)
+	configLock.RLock()
+	config := currentConfig
+	configLock.RUnlock()
+	config.Search.Results = 6
+	// the size changes along with the results, whatever the precision of modification times
+	config.Joke.Sources = []string{redditUpstream}
+	writeConfigFile(t, filename, config)
+	waitForResults(t, 6)
+}
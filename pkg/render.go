@@ -0,0 +1,274 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/raf924/connector-sdk/command"
+	"strings"
+	"sync"
+)
+
+// formatKey is the ApiKeys entry naming the Renderer to use, markdown being the default
+const formatKey = "format"
+
+// Renderer turns the elements of a Reply into text suitable for a connector
+type Renderer interface {
+	Title(title Title) string
+	Heading(text string) string
+	Text(text string) string
+	Link(link Link) string
+	Quote(text string) string
+	List(items []string) string
+	Field(field Field) string
+}
+
+// Element is a part of a Reply
+type Element interface {
+	Render(renderer Renderer) string
+}
+
+// Reply is the structured answer of a command, each of its elements being rendered on its own line(s)
+type Reply []Element
+
+func (r Reply) Render(renderer Renderer) string {
+	lines := make([]string, 0, len(r))
+	for _, element := range r {
+		lines = append(lines, element.Render(renderer))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Title introduces a result, Link being optional
+type Title struct {
+	Text string
+	Link string
+}
+
+func (t Title) Render(renderer Renderer) string {
+	return renderer.Title(t)
+}
+
+// Heading introduces a section of a Reply
+type Heading string
+
+func (h Heading) Render(renderer Renderer) string {
+	return renderer.Heading(string(h))
+}
+
+type Text string
+
+func (t Text) Render(renderer Renderer) string {
+	return renderer.Text(string(t))
+}
+
+// Link is a link whose Text is optional
+type Link struct {
+	Text string
+	Url  string
+}
+
+func (l Link) Render(renderer Renderer) string {
+	return renderer.Link(l)
+}
+
+type Quote string
+
+func (q Quote) Render(renderer Renderer) string {
+	return renderer.Quote(string(q))
+}
+
+type List []string
+
+func (l List) Render(renderer Renderer) string {
+	return renderer.List(l)
+}
+
+// Field is a named value
+type Field struct {
+	Name  string
+	Value string
+}
+
+func (f Field) Render(renderer Renderer) string {
+	return renderer.Field(f)
+}
+
+func prefixLines(prefix string, text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+var _ Renderer = MarkdownRenderer{}
+
+// MarkdownRenderer renders replies as Markdown, quotes included
+type MarkdownRenderer struct{}
+
+func (m MarkdownRenderer) Title(title Title) string {
+	if len(title.Link) == 0 {
+		return fmt.Sprintf(">#### %s", title.Text)
+	}
+	return fmt.Sprintf(">#### [%s](%s)", title.Text, title.Link)
+}
+
+func (m MarkdownRenderer) Heading(text string) string {
+	return fmt.Sprintf(">### %s", text)
+}
+
+func (m MarkdownRenderer) Text(text string) string {
+	return text
+}
+
+func (m MarkdownRenderer) Link(link Link) string {
+	if len(link.Text) == 0 {
+		return link.Url
+	}
+	return fmt.Sprintf("[%s](%s)", link.Text, link.Url)
+}
+
+func (m MarkdownRenderer) Quote(text string) string {
+	return prefixLines(">", text)
+}
+
+func (m MarkdownRenderer) List(items []string) string {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		lines[i] = ">- " + item
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m MarkdownRenderer) Field(field Field) string {
+	return fmt.Sprintf("%s: %s", field.Name, field.Value)
+}
+
+var _ Renderer = PlainRenderer{}
+
+// PlainRenderer renders replies without any markup
+type PlainRenderer struct{}
+
+func (p PlainRenderer) Title(title Title) string {
+	if len(title.Link) == 0 {
+		return title.Text
+	}
+	return fmt.Sprintf("%s - %s", title.Text, title.Link)
+}
+
+func (p PlainRenderer) Heading(text string) string {
+	return text + ":"
+}
+
+func (p PlainRenderer) Text(text string) string {
+	return text
+}
+
+func (p PlainRenderer) Link(link Link) string {
+	if len(link.Text) == 0 {
+		return link.Url
+	}
+	return fmt.Sprintf("%s (%s)", link.Text, link.Url)
+}
+
+func (p PlainRenderer) Quote(text string) string {
+	return prefixLines("  ", text)
+}
+
+func (p PlainRenderer) List(items []string) string {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		lines[i] = "- " + item
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p PlainRenderer) Field(field Field) string {
+	return fmt.Sprintf("%s: %s", field.Name, field.Value)
+}
+
+// IRC formatting control codes
+const (
+	ircBold   = "\x02"
+	ircItalic = "\x1D"
+)
+
+var _ Renderer = IrcRenderer{}
+
+// IrcRenderer renders replies with IRC formatting control codes
+type IrcRenderer struct{}
+
+func (i IrcRenderer) Title(title Title) string {
+	if len(title.Link) == 0 {
+		return ircBold + title.Text + ircBold
+	}
+	return fmt.Sprintf("%s%s%s - %s", ircBold, title.Text, ircBold, title.Link)
+}
+
+func (i IrcRenderer) Heading(text string) string {
+	return ircBold + text + ircBold
+}
+
+func (i IrcRenderer) Text(text string) string {
+	return text
+}
+
+func (i IrcRenderer) Link(link Link) string {
+	if len(link.Text) == 0 {
+		return link.Url
+	}
+	return fmt.Sprintf("%s (%s)", link.Text, link.Url)
+}
+
+func (i IrcRenderer) Quote(text string) string {
+	lines := strings.Split(text, "\n")
+	for j, line := range lines {
+		if len(line) > 0 {
+			// formatting does not span lines on IRC
+			lines[j] = ircItalic + line + ircItalic
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (i IrcRenderer) List(items []string) string {
+	lines := make([]string, len(items))
+	for j, item := range items {
+		lines[j] = "• " + item
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (i IrcRenderer) Field(field Field) string {
+	return fmt.Sprintf("%s%s:%s %s", ircBold, field.Name, ircBold, field.Value)
+}
+
+var (
+	renderersLock sync.RWMutex
+	renderers     = map[string]Renderer{
+		"markdown": MarkdownRenderer{},
+		"plain":    PlainRenderer{},
+		"irc":      IrcRenderer{},
+	}
+)
+
+// RegisterRenderer makes renderer available to the commands under name, to be selected with the "format" ApiKeys entry
+func RegisterRenderer(name string, renderer Renderer) {
+	renderersLock.Lock()
+	renderers[name] = renderer
+	renderersLock.Unlock()
+}
+
+// rendererFor returns the Renderer selected through the executor
+func rendererFor(executor command.Executor) (Renderer, error) {
+	format := executor.ApiKeys()[formatKey]
+	if len(format) == 0 {
+		return MarkdownRenderer{}, nil
+	}
+	renderersLock.RLock()
+	renderer, ok := renderers[format]
+	renderersLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+	return renderer, nil
+}
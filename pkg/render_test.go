@@ -0,0 +1,44 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"testing"
+)
+
+func TestReplyRender(t *testing.T) {
+	reply := pkg.Reply{
+		pkg.Title{Text: "Go", Link: "https://go.dev"},
+		pkg.Heading("Definitions"),
+		pkg.Quote("simple\nreliable"),
+		pkg.List{"fast", "fun"},
+		pkg.Field{Name: "Units", Value: "metric"},
+		pkg.Link{Text: "Tour", Url: "https://go.dev/tour"},
+		pkg.Text("done"),
+	}
+	tests := []struct {
+		name     string
+		renderer pkg.Renderer
+		want     string
+	}{
+		{"markdown", pkg.MarkdownRenderer{}, ">#### [Go](https://go.dev)\n>### Definitions\n>simple\n>reliable\n>- fast\n>- fun\n" +
+			"Units: metric\n[Tour](https://go.dev/tour)\ndone"},
+		{"plain", pkg.PlainRenderer{}, "Go - https://go.dev\nDefinitions:\n  simple\n  reliable\n- fast\n- fun\n" +
+			"Units: metric\nTour (https://go.dev/tour)\ndone"},
+		{"irc", pkg.IrcRenderer{}, "\x02Go\x02 - https://go.dev\n\x02Definitions\x02\n\x1Dsimple\x1D\n\x1Dreliable\x1D\n• fast\n• fun\n" +
+			"\x02Units:\x02 metric\nTour (https://go.dev/tour)\ndone"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := reply.Render(test.renderer); got != test.want {
+				t.Errorf("Render() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReplyRenderWithoutLinks(t *testing.T) {
+	reply := pkg.Reply{pkg.Title{Text: "Go"}, pkg.Link{Url: "https://go.dev"}}
+	if got, want := reply.Render(pkg.PlainRenderer{}), "Go\nhttps://go.dev"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,274 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	maxRetries       = 2
+	retryBaseDelay   = 200 * time.Millisecond
+	retryMaxDelay    = 2 * time.Second
+	failureThreshold = 5
+	openCircuitDelay = 30 * time.Second
+)
+
+type circuitState string
+
+const (
+	circuitClosed   circuitState = "closed"
+	circuitOpen     circuitState = "open"
+	circuitHalfOpen circuitState = "half-open"
+)
+
+type circuitOpenError struct {
+	Host string
+}
+
+func (c *circuitOpenError) Error() string {
+	return fmt.Sprintf("%s is currently unavailable, try again later", c.Host)
+}
+
+// circuitBreaker stops calls to a host after failureThreshold consecutive failures.
+// Once openCircuitDelay has elapsed, a single call is let through to probe the host:
+// the circuit closes if it succeeds and opens again otherwise.
+type circuitBreaker struct {
+	m        sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	lastErr  error
+	// failedAt is when lastErr happened
+	failedAt time.Time
+}
+
+func (c *circuitBreaker) allow() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	switch c.state {
+	case circuitOpen:
+		if time.Since(c.openedAt) < openCircuitDelay {
+			return false
+		}
+		c.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// the probing call is still running
+		return false
+	}
+	return true
+}
+
+func (c *circuitBreaker) success() {
+	c.m.Lock()
+	c.state = circuitClosed
+	c.failures = 0
+	c.m.Unlock()
+}
+
+func (c *circuitBreaker) failure(err error) {
+	c.m.Lock()
+	c.failures++
+	c.lastErr = err
+	c.failedAt = time.Now()
+	if c.state == circuitHalfOpen || c.failures >= failureThreshold {
+		c.state = circuitOpen
+		c.openedAt = time.Now()
+	}
+	c.m.Unlock()
+}
+
+// release lets another call probe the host when the probing one ended without telling anything about it
+func (c *circuitBreaker) release() {
+	c.m.Lock()
+	if c.state == circuitHalfOpen {
+		c.state = circuitOpen
+		c.openedAt = time.Time{}
+	}
+	c.m.Unlock()
+}
+
+func (c *circuitBreaker) currentState() circuitState {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if len(c.state) == 0 {
+		return circuitClosed
+	}
+	return c.state
+}
+
+// lastFailure returns the error of the last failed call and when it happened, if any failed
+func (c *circuitBreaker) lastFailure() (error, time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.lastErr, c.failedAt
+}
+
+type circuitBreakers struct {
+	m        sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+var hostBreakers = &circuitBreakers{breakers: map[string]*circuitBreaker{}}
+
+func (c *circuitBreakers) get(host string) *circuitBreaker {
+	c.m.Lock()
+	defer c.m.Unlock()
+	breaker, ok := c.breakers[host]
+	if !ok {
+		breaker = &circuitBreaker{state: circuitClosed}
+		c.breakers[host] = breaker
+	}
+	return breaker
+}
+
+// lookup returns the breaker of host if it has been called
+func (c *circuitBreakers) lookup(host string) (*circuitBreaker, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	breaker, ok := c.breakers[host]
+	return breaker, ok
+}
+
+// states returns the state of the circuit of every host called so far
+func (c *circuitBreakers) states() map[string]circuitState {
+	c.m.Lock()
+	breakers := make(map[string]*circuitBreaker, len(c.breakers))
+	for host, breaker := range c.breakers {
+		breakers[host] = breaker
+	}
+	c.m.Unlock()
+	states := make(map[string]circuitState, len(breakers))
+	for host, breaker := range breakers {
+		states[host] = breaker.currentState()
+	}
+	return states
+}
+
+type callerKey struct{}
+
+// withCaller keeps ctx, the context of the caller of an upstream, in the requests it makes,
+// whose context also ends when the http.Client times out
+func withCaller(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callerKey{}, ctx)
+}
+
+// abandoned tells whether the caller of request gave up on it, e.g. because its invocation was cancelled,
+// which tells nothing about the upstream unlike a timeout
+func abandoned(request *http.Request) bool {
+	caller, ok := request.Context().Value(callerKey{}).(context.Context)
+	if !ok {
+		caller = request.Context()
+	}
+	return caller.Err() != nil
+}
+
+// isUpstreamFailure tells whether the outcome of a call that was not abandoned means the upstream is unhealthy,
+// in which case it is worth retrying
+func isUpstreamFailure(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return response.StatusCode >= 500
+}
+
+// retryAfter returns the delay the upstream asked for in the Retry-After header of response, if it did
+func retryAfter(response *http.Response, now time.Time) (time.Duration, bool) {
+	if response == nil {
+		return 0, false
+	}
+	header := response.Header.Get("Retry-After")
+	if len(header) == 0 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		if delay := at.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// backoff returns a random delay, growing with each attempt, to wait before retrying
+func backoff(attempt int) time.Duration {
+	ceiling := retryBaseDelay << attempt
+	if ceiling > retryMaxDelay {
+		ceiling = retryMaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// resilientTransport retries idempotent requests that failed because of their upstream
+// and fails fast when the upstream host's circuit is open
+type resilientTransport struct {
+	base http.RoundTripper
+}
+
+func (r *resilientTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	breaker := hostBreakers.get(request.URL.Host)
+	if !breaker.allow() {
+		return nil, &circuitOpenError{Host: request.URL.Host}
+	}
+	retries := maxRetries
+	if (request.Method != http.MethodGet && request.Method != http.MethodHead) || request.Body != nil {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		response, err := r.base.RoundTrip(request)
+		if abandoned(request) {
+			breaker.release()
+			return response, err
+		}
+		if !isUpstreamFailure(response, err) {
+			breaker.success()
+			return response, err
+		}
+		failure := err
+		if failure == nil {
+			failure = &statusError{StatusCode: response.StatusCode, Status: response.Status}
+		}
+		delay := backoff(attempt)
+		if after, ok := retryAfter(response, time.Now()); ok {
+			delay = after
+		}
+		// the deadline is the earliest of the timeout of the client and the one of the invocation
+		remaining := invocationTimeout
+		if deadline, ok := request.Context().Deadline(); ok {
+			remaining = time.Until(deadline)
+		}
+		if attempt >= retries || delay >= remaining {
+			breaker.failure(failure)
+			return response, err
+		}
+		if response != nil {
+			_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, defaultMaxBodySize))
+			_ = response.Body.Close()
+		}
+		loggerFrom(request.Context()).Debug("retrying upstream call", "upstream", request.URL.Host, "attempt", attempt+1)
+		select {
+		case <-request.Context().Done():
+			if abandoned(request) {
+				breaker.release()
+			} else {
+				breaker.failure(failure)
+			}
+			return nil, request.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hangingServer answers nothing until the caller gives up
+func hangingServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-request.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func breakerOf(t *testing.T, rawUrl string) *circuitBreaker {
+	t.Helper()
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+	return hostBreakers.get(u.Host)
+}
+
+func TestResilientTransportCountsTimeouts(t *testing.T) {
+	server := hangingServer(t)
+	client := newHttpClient(20*time.Millisecond, defaultMaxBodySize)
+	for i := 0; i < failureThreshold; i++ {
+		if _, err := client.get(context.Background(), server.URL, nil); err == nil {
+			t.Fatalf("get() #%d error = nil, want a timeout", i+1)
+		}
+	}
+	breaker := breakerOf(t, server.URL)
+	if state := breaker.currentState(); state != circuitOpen {
+		t.Errorf("circuit = %s after %d timeouts, want it open", state, failureThreshold)
+	}
+	var circuitErr *circuitOpenError
+	if _, err := client.get(context.Background(), server.URL, nil); !errors.As(err, &circuitErr) {
+		t.Errorf("get() error = %v, want to fail fast on the open circuit", err)
+	}
+}
+
+func TestResilientTransportReleasesAbandonedCalls(t *testing.T) {
+	server := hangingServer(t)
+	client := newHttpClient(time.Minute, defaultMaxBodySize)
+	for i := 0; i < failureThreshold; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := client.get(ctx, server.URL, nil)
+		cancel()
+		if err == nil {
+			t.Fatalf("get() #%d error = nil, want the call abandoned", i+1)
+		}
+	}
+	breaker := breakerOf(t, server.URL)
+	if state, failures := breaker.currentState(), breaker.failures; state != circuitClosed || failures != 0 {
+		t.Errorf("circuit = %s with %d failures, want abandoned calls left out", state, failures)
+	}
+}
+
+func TestResilientTransportRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			writer.Header().Set("Retry-After", "0")
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = writer.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	body, err := newHttpClient(time.Second, defaultMaxBodySize).get(context.Background(), server.URL, nil)
+	if err != nil || string(body) != "ok" || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("get() = %q, %v after %d calls, want ok once retried", body, err, calls)
+	}
+	if state := breakerOf(t, server.URL).currentState(); state != circuitClosed {
+		t.Errorf("circuit = %s, want it closed by the success", state)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := &circuitBreaker{state: circuitClosed}
+	for i := 0; i < failureThreshold-1; i++ {
+		breaker.failure(errors.New("unavailable"))
+	}
+	if !breaker.allow() {
+		t.Fatalf("allow() = false below the threshold, want true")
+	}
+	breaker.failure(errors.New("unavailable"))
+	if breaker.allow() {
+		t.Fatalf("allow() = true at the threshold, want the circuit open")
+	}
+	breaker.openedAt = time.Now().Add(-openCircuitDelay)
+	if !breaker.allow() || breaker.allow() {
+		t.Fatalf("allow() after the delay, want a single call probing the host")
+	}
+	breaker.release()
+	if !breaker.allow() {
+		t.Fatalf("allow() = false once the probe released, want another probe")
+	}
+	breaker.success()
+	if state := breaker.currentState(); state != circuitClosed || breaker.failures != 0 {
+		t.Errorf("circuit = %s with %d failures, want it closed by the probe", state, breaker.failures)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		delay  time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, test := range tests {
+		response := &http.Response{Header: http.Header{}}
+		response.Header.Set("Retry-After", test.header)
+		if delay, ok := retryAfter(response, now); delay != test.delay || ok != test.ok {
+			t.Errorf("retryAfter(%q) = %s, %v, want %s, %v", test.header, delay, ok, test.delay, test.ok)
+		}
+	}
+}
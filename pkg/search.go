@@ -1,16 +1,61 @@
 package pkg
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
-	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 var _ command.Command = (*SearchCommand)(nil)
+var _ Helper = (*SearchCommand)(nil)
+var _ ContextExecutable = (*SearchCommand)(nil)
+
+const (
+	searchTimeout       = 10 * time.Second
+	searchPageSize      = 5
+	defaultSearchLocale = "en_US"
+)
+
+var searchOptions = []commandOption{
+	{name: "lang", short: "l"},
+	{name: "results", short: "n", kind: intOption, min: 1, max: 10},
+}
+
+// searchCountries are the countries of the locales of the languages whose code is not the one of their country
+var searchCountries = map[string]string{
+	"en": "US",
+	"ja": "JP",
+	"ko": "KR",
+	"zh": "CN",
+	"cs": "CZ",
+	"da": "DK",
+	"el": "GR",
+	"sv": "SE",
+}
+
+// searchLocale turns lang, either a language ("fr") or a locale ("fr-CA"), into the locale of qwant ("fr_CA")
+func searchLocale(lang string) string {
+	parts := strings.FieldsFunc(lang, func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+	if len(parts) == 0 {
+		return defaultSearchLocale
+	}
+	language := strings.ToLower(parts[0])
+	if len(parts) > 1 {
+		return language + "_" + strings.ToUpper(parts[1])
+	}
+	if country, ok := searchCountries[language]; ok {
+		return language + "_" + country
+	}
+	return language + "_" + strings.ToUpper(language)
+}
 
 type MainlineItem struct {
 	Title           string        `json:"title"`
@@ -48,12 +93,53 @@ type SearchResponse struct {
 	} `json:"data"`
 }
 
+// searchSettings are the settings of SearchCommand coming from the Config
+type searchSettings struct {
+	searchUrl *url.URL
+	pageSize  int
+}
+
 type SearchCommand struct {
 	command.NoOpInterceptor
+	current  atomic.Value
+	client   *httpClient
+	renderer Renderer
+	trigger  string
+}
+
+func (s *SearchCommand) Init(executor command.Executor) error {
+	if err := setUp(executor); err != nil {
+		return err
+	}
+	var err error
+	s.client = newHttpClient(searchTimeout, defaultMaxBodySize)
+	s.trigger = executor.Trigger()
+	s.renderer, err = rendererFor(executor)
+	if err != nil {
+		return err
+	}
+	return configureCommand(s, executor)
 }
 
-func (s *SearchCommand) Init(command.Executor) error {
-	return nil
+func (s *SearchCommand) configure(config commandConfig) (func(), error) {
+	qwantUrl, err := config.endpoint(qwantUpstream)
+	if err != nil {
+		return nil, err
+	}
+	searchUrl := endpointUrl(qwantUrl, "v3", "search", "web")
+	searchUrl.RawQuery = url.Values{
+		"origin":     {"suggest"},
+		"count":      {"10"},
+		"offset":     {"0"},
+		"safesearch": {strconv.Itoa(config.Search.SafeSearch)},
+		"locale":     {searchLocale(config.Search.Locale)},
+	}.Encode()
+	settings := &searchSettings{searchUrl: searchUrl, pageSize: config.Search.Results}
+	return func() { s.current.Store(settings) }, nil
+}
+
+func (s *SearchCommand) settings() *searchSettings {
+	return s.current.Load().(*searchSettings)
 }
 
 func (s *SearchCommand) Name() string {
@@ -64,6 +150,22 @@ func (s *SearchCommand) Aliases() []string {
 	return []string{"s", "g", "google"}
 }
 
+func (s *SearchCommand) Usage() string {
+	return "<terms> " + optionsUsage(searchOptions)
+}
+
+func (s *SearchCommand) Description() string {
+	return "Searches the web"
+}
+
+func (s *SearchCommand) Examples() []string {
+	return []string{"golang generics", "-n 3 --lang=fr \"tour eiffel\""}
+}
+
+func (s *SearchCommand) upstreams() []string {
+	return []string{qwantUpstream}
+}
+
 func findWebResults(result []MainlineResult) ([]MainlineResult, error) {
 	var webResults []MainlineResult
 	for _, item := range result {
@@ -72,52 +174,70 @@ func findWebResults(result []MainlineResult) ([]MainlineResult, error) {
 		}
 	}
 	if len(webResults) == 0 {
-		return nil, fmt.Errorf("no web result found")
+		return nil, notFound("No web result found")
 	}
 	return webResults, nil
 }
 
 func (s *SearchCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
-	searchTerms := strings.TrimSpace(command.ArgString())
-	searchUrl, _ := url.Parse("https://api.qwant.com/v3/search/web?origin=suggest&count=10&offset=0&safesearch=1&locale=en_US")
-	searchQuery := searchUrl.Query()
-	searchQuery.Set("q", searchTerms)
-	searchUrl.RawQuery = searchQuery.Encode()
-	req, err := http.NewRequest(http.MethodGet, searchUrl.String(), nil)
+	return execute(s, command)
+}
+
+func (s *SearchCommand) ExecuteContext(ctx context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	args, err := parseArgs(command.ArgString(), searchOptions...)
 	if err != nil {
 		return nil, err
 	}
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+	terms := make([]string, len(args.positional))
+	for i, term := range args.positional {
+		// quoted phrases must be matched exactly
+		if strings.ContainsAny(term, " \t") {
+			term = strconv.Quote(term)
+		}
+		terms[i] = term
+	}
+	searchTerms := strings.Join(terms, " ")
+	if len(searchTerms) == 0 {
+		return nil, badInput("What should I search for?")
+	}
+	settings := s.settings()
+	searchUrl := *settings.searchUrl
+	searchQuery := searchUrl.Query()
+	searchQuery.Set("q", searchTerms)
+	locale := setting(ctx, "locale", "")
+	if prefs := preferencesOf(command.Sender()); len(prefs.Locale) > 0 {
+		locale = prefs.Locale
+	}
+	if lang := args.string("lang", locale); len(lang) > 0 {
+		searchQuery.Set("locale", searchLocale(lang))
 	}
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("call is error %d, %s", res.StatusCode, res.Status)
+	safeSearch := setting(ctx, "safesearch", searchQuery.Get("safesearch"))
+	if safeSearch != "0" && safeSearch != "1" && safeSearch != "2" {
+		return nil, fmt.Errorf("invalid safesearch setting %q, expected 0, 1 or 2", safeSearch)
 	}
+	searchQuery.Set("safesearch", safeSearch)
+	searchUrl.RawQuery = searchQuery.Encode()
 	var searchResponse SearchResponse
-	err = json.NewDecoder(res.Body).Decode(&searchResponse)
+	err = s.client.getJSON(ctx, searchUrl.String(), &searchResponse)
 	if err != nil {
-		return nil, err
+		return nil, upstreamError(qwantUpstream, err)
 	}
-	message := ""
+	var results []Reply
 	webResults, err := findWebResults(searchResponse.Data.Result.Items.Mainline)
 	if err != nil {
 		return nil, err
 	}
-	count := 0
 	for _, webResult := range webResults {
 		for _, item := range webResult.Items {
-			message += fmt.Sprintf(">#### [%s](%s)\n%s\n\n", item.Title, item.Url, item.Desc)
-			count += 1
-			if count == 5 {
-				break
-			}
-		}
-		if count == 5 {
-			break
+			results = append(results, Reply{Title{Text: item.Title, Link: item.Url}, Text(item.Desc + "\n")})
 		}
 	}
+	pages := chunk(results, args.int("results", settings.pageSize))
+	if len(pages) == 0 {
+		return nil, notFound("No result found for %q", searchTerms)
+	}
+	reply := paginate(command, s.trigger, pages[0], staticPages(pages[1:]))
 	return []*domain.ClientMessage{
-		domain.NewClientMessage(message, command.Sender(), command.Private()),
+		domain.NewClientMessage(reply.Render(s.renderer), command.Sender(), command.Private()),
 	}, nil
 }
@@ -0,0 +1,49 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"net/http"
+	"testing"
+)
+
+func TestSearchCommand(t *testing.T) {
+	server, executor := newServer(t)
+	search := &pkg.SearchCommand{}
+	initCommand(t, search, executor)
+	assertTexts(t, run(t, search, servicetest.NewUser("alice"), "golang", false),
+		"The Go Programming Language - https://go.dev/\n"+
+			"Go is an open source programming language that makes it simple to build secure, scalable systems.\n\n"+
+			"Go (programming language) - Wikipedia - https://en.wikipedia.org/wiki/Go_(programming_language)\n"+
+			"Go is a statically typed, compiled high-level programming language designed at Google.\n\n"+
+			"A Tour of Go - https://go.dev/tour/\n"+
+			"Welcome to a tour of the Go programming language.\n\n"+
+			"Effective Go - https://go.dev/doc/effective_go\n"+
+			"Tips for writing clear, idiomatic Go code.\n\n"+
+			"golang/go - GitHub - https://github.com/golang/go\n"+
+			"The Go programming language.\n\n"+
+			"(1 more, use !more)")
+	requests := server.Requests("qwant")
+	if len(requests) != 1 {
+		t.Fatalf("qwant requests = %d, want 1", len(requests))
+	}
+	if query := requests[0].Query(); query.Get("q") != "golang" || query.Get("locale") != "en_US" || query.Get("safesearch") != "1" {
+		t.Errorf("qwant query = %s, want golang searched in en_US with safesearch 1", requests[0].RawQuery)
+	}
+}
+
+func TestSearchCommandWithoutTerms(t *testing.T) {
+	_, executor := newServer(t)
+	search := &pkg.SearchCommand{}
+	initCommand(t, search, executor)
+	assertTexts(t, run(t, search, servicetest.NewUser("alice"), "", false), "What should I search for?")
+}
+
+func TestSearchCommandUnavailable(t *testing.T) {
+	server, executor := newServer(t)
+	server.Fail("qwant", http.StatusServiceUnavailable)
+	search := &pkg.SearchCommand{}
+	initCommand(t, search, executor)
+	assertTexts(t, run(t, search, servicetest.NewUser("alice"), "golang", false),
+		"qwant is unavailable right now, please try again later")
+}
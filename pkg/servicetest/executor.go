@@ -0,0 +1,59 @@
+// Package servicetest provides what is needed to exercise the commands of pkg without any network access:
+// a fake command.Executor, message builders and a server replaying recorded upstream responses.
+package servicetest
+
+import (
+	"github.com/raf924/connector-sdk/command"
+	"github.com/raf924/connector-sdk/domain"
+)
+
+var _ command.Executor = (*Executor)(nil)
+
+// Executor is a command.Executor whose state is set by the test
+type Executor struct {
+	Bot   *domain.User
+	Keys  map[string]string
+	Users domain.UserList
+	// Prefix is the command trigger, "!" if empty
+	Prefix string
+	// Permissions tells whether a user has a permission, every permission being granted if nil
+	Permissions func(user *domain.User, permission domain.Permission) bool
+}
+
+// NewExecutor returns an Executor with the given ApiKeys
+func NewExecutor(keys map[string]string) *Executor {
+	if keys == nil {
+		keys = map[string]string{}
+	}
+	return &Executor{
+		Bot:   domain.NewUser("bot", "bot", domain.RegularUser),
+		Keys:  keys,
+		Users: domain.NewUserList(),
+	}
+}
+
+func (e *Executor) BotUser() *domain.User {
+	return e.Bot
+}
+
+func (e *Executor) ApiKeys() map[string]string {
+	return e.Keys
+}
+
+func (e *Executor) OnlineUsers() domain.UserList {
+	return e.Users
+}
+
+func (e *Executor) UserHasPermission(user *domain.User, permission domain.Permission) bool {
+	if e.Permissions == nil {
+		return true
+	}
+	return e.Permissions(user, permission)
+}
+
+func (e *Executor) Trigger() string {
+	if len(e.Prefix) == 0 {
+		return "!"
+	}
+	return e.Prefix
+}
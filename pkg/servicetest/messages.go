@@ -0,0 +1,38 @@
+package servicetest
+
+import (
+	"fmt"
+	"github.com/raf924/connector-sdk/domain"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var userCount uint64
+
+// NewUser returns a regular user with a unique id,
+// which keeps the state the commands hold per user, such as rate limits, apart between tests
+func NewUser(nick string) *domain.User {
+	id := atomic.AddUint64(&userCount, 1)
+	return domain.NewUser(nick, fmt.Sprintf("%s-%d", nick, id), domain.RegularUser)
+}
+
+// NewCommandMessage returns the message sent by sender when typing the command followed by argString
+func NewCommandMessage(sender *domain.User, command string, argString string, private bool) *domain.CommandMessage {
+	return domain.NewCommandMessage(command, strings.Fields(argString), argString, sender, private, time.Now())
+}
+
+// NewChatMessage returns a chat message sent by sender
+func NewChatMessage(sender *domain.User, message string, private bool) *domain.ChatMessage {
+	var recipients []*domain.User
+	return domain.NewChatMessage(message, sender, recipients, false, private, time.Now(), true)
+}
+
+// Texts returns the text of each message
+func Texts(messages []*domain.ClientMessage) []string {
+	texts := make([]string, len(messages))
+	for i, message := range messages {
+		texts[i] = message.Message()
+	}
+	return texts
+}
@@ -0,0 +1,178 @@
+package servicetest
+
+import (
+	"embed"
+	"fmt"
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+//go:embed fixtures
+var recorded embed.FS
+
+// Fixture is a response replayed by a Server
+type Fixture struct {
+	Upstream string
+	// Path is relative to the base URL of the upstream, a trailing "*" matching any suffix
+	Path string
+	// Query holds the parameters a request must have to get the fixture, whatever their other ones
+	Query       url.Values
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+func (f *Fixture) matches(upstream string, request *http.Request, requestPath string) bool {
+	if f.Upstream != upstream {
+		return false
+	}
+	if strings.HasSuffix(f.Path, "*") {
+		if !strings.HasPrefix(requestPath, strings.TrimSuffix(f.Path, "*")) {
+			return false
+		}
+	} else if f.Path != requestPath {
+		return false
+	}
+	query := request.URL.Query()
+	for key, values := range f.Query {
+		for _, value := range values {
+			if query.Get(key) != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func recordedFixture(upstream string, fixturePath string, query url.Values, file string, contentType string) Fixture {
+	body, err := recorded.ReadFile(path.Join("fixtures", upstream, file))
+	if err != nil {
+		panic(err)
+	}
+	return Fixture{Upstream: upstream, Path: fixturePath, Query: query, Status: http.StatusOK, ContentType: contentType, Body: body}
+}
+
+// RecordedFixtures returns responses recorded from each upstream
+func RecordedFixtures() []Fixture {
+	const jsonType, xmlType = "application/json", "text/xml; charset=utf-8"
+	return []Fixture{
+		recordedFixture("qwant", "/v3/search/web", nil, "search.json", jsonType),
+		recordedFixture("dictionary", "/api/v2/entries/en/*", nil, "entries.json", jsonType),
+		recordedFixture("geocoding", "/search", nil, "search.json", jsonType),
+		recordedFixture("timeapi", "/api/TimeZone/coordinate", nil, "coordinate.json", jsonType),
+		recordedFixture("openweather", "/data/2.5/forecast", nil, "forecast.json", jsonType),
+		recordedFixture("openweather", "/data/3.0/onecall", nil, "onecall.json", jsonType),
+		recordedFixture("openmeteo", "/v1/forecast", nil, "forecast.json", jsonType),
+		recordedFixture("wikipedia", "/w/api.php", url.Values{"list": {"search"}}, "search.xml", xmlType),
+		recordedFixture("wikipedia", "/w/api.php", url.Values{"prop": {"extracts"}}, "extract.xml", xmlType),
+		recordedFixture("wikipedia", "/w/api.php", url.Values{"prop": {"info"}}, "info.xml", xmlType),
+		recordedFixture("urban", "/v0/define", nil, "define.json", jsonType),
+		recordedFixture("reddit", "/r/jokes/.json", nil, "jokes.json", jsonType),
+		recordedFixture("dadjoke", "/", nil, "joke.txt", "text/plain"),
+		recordedFixture("youtube", "/watch", nil, "watch.html", "text/html; charset=utf-8"),
+		recordedFixture("youtubeapi", "/youtube/v3/videos", nil, "videos.json", jsonType),
+	}
+}
+
+// EmptyFixtures returns recorded responses of upstreams that found nothing, to be passed to Server.Handle
+func EmptyFixtures() []Fixture {
+	notFound := recordedFixture("dictionary", "/api/v2/entries/en/*", nil, "not_found.json", "application/json")
+	notFound.Status = http.StatusNotFound
+	return []Fixture{
+		notFound,
+		{Upstream: "geocoding", Path: "/search", Status: http.StatusOK, ContentType: "application/json", Body: []byte("[]")},
+		recordedFixture("wikipedia", "/w/api.php", url.Values{"list": {"search"}}, "empty.xml", "text/xml; charset=utf-8"),
+		recordedFixture("urban", "/v0/define", nil, "empty.json", "application/json"),
+	}
+}
+
+// Server replays fixtures in place of every upstream, each of them being served under a path named after it
+type Server struct {
+	*httptest.Server
+	m        sync.Mutex
+	fixtures []Fixture
+	requests map[string][]*url.URL
+}
+
+// NewServer starts a Server replaying the recorded fixtures. It must be closed once done with.
+func NewServer() *Server {
+	s := &Server{fixtures: RecordedFixtures(), requests: map[string][]*url.URL{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *Server) serve(writer http.ResponseWriter, request *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(request.URL.Path, "/"), "/", 2)
+	upstream, requestPath := parts[0], "/"
+	if len(parts) > 1 {
+		requestPath += parts[1]
+	}
+	s.m.Lock()
+	requestUrl := *request.URL
+	requestUrl.Path = requestPath
+	s.requests[upstream] = append(s.requests[upstream], &requestUrl)
+	var fixture *Fixture
+	for i := range s.fixtures {
+		if s.fixtures[i].matches(upstream, request, requestPath) {
+			fixture = &s.fixtures[i]
+			break
+		}
+	}
+	s.m.Unlock()
+	if fixture == nil {
+		http.Error(writer, fmt.Sprintf("no fixture for %s %s", upstream, requestPath), http.StatusNotFound)
+		return
+	}
+	if len(fixture.ContentType) > 0 {
+		writer.Header().Set("Content-Type", fixture.ContentType)
+	}
+	writer.WriteHeader(fixture.Status)
+	_, _ = writer.Write(fixture.Body)
+}
+
+// Handle makes the server reply with the given fixtures, which take precedence over the ones it already has
+func (s *Server) Handle(fixtures ...Fixture) {
+	s.m.Lock()
+	s.fixtures = append(append([]Fixture{}, fixtures...), s.fixtures...)
+	s.m.Unlock()
+}
+
+// Fail makes every request to upstream fail with status
+func (s *Server) Fail(upstream string, status int) {
+	s.Handle(Fixture{Upstream: upstream, Path: "/*", Status: status, ContentType: "text/plain", Body: []byte(http.StatusText(status))})
+}
+
+// Requests returns copies of the URLs requested from upstream, relatively to its base URL
+func (s *Server) Requests(upstream string) []*url.URL {
+	s.m.Lock()
+	defer s.m.Unlock()
+	requests := make([]*url.URL, len(s.requests[upstream]))
+	for i, request := range s.requests[upstream] {
+		requestUrl := *request
+		requests[i] = &requestUrl
+	}
+	return requests
+}
+
+// UpstreamUrl returns the base URL under which upstream is replayed
+func (s *Server) UpstreamUrl(upstream string) string {
+	return s.URL + "/" + upstream
+}
+
+// Executor returns an Executor pointing every upstream of the commands at the server,
+// with placeholder API keys so that the commands use the upstreams requiring one
+func (s *Server) Executor() *Executor {
+	keys := map[string]string{
+		"openweather": "test-openweather-key",
+		"youtube":     "test-youtube-key",
+	}
+	for _, upstream := range pkg.Upstreams() {
+		keys[pkg.EndpointKey(upstream)] = s.UpstreamUrl(upstream)
+	}
+	return NewExecutor(keys)
+}
@@ -0,0 +1,117 @@
+package servicetest_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func get(t *testing.T, rawUrl string) (int, string) {
+	t.Helper()
+	response, err := http.Get(rawUrl)
+	if err != nil {
+		t.Fatalf("GET %s error = %v", rawUrl, err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("GET %s error = %v", rawUrl, err)
+	}
+	return response.StatusCode, string(body)
+}
+
+func TestServerReplaysRecordedFixtures(t *testing.T) {
+	server := servicetest.NewServer()
+	defer server.Close()
+	status, body := get(t, server.UpstreamUrl("dadjoke"))
+	if status != http.StatusOK || body != "I'm reading a book about anti-gravity. It's impossible to put down." {
+		t.Errorf("dadjoke = %d %q, want the recorded joke", status, body)
+	}
+	// a trailing "*" matches any suffix
+	if status, _ := get(t, server.UpstreamUrl("dictionary")+"/api/v2/entries/en/anything"); status != http.StatusOK {
+		t.Errorf("dictionary status = %d, want %d", status, http.StatusOK)
+	}
+	if status, _ := get(t, server.UpstreamUrl("dictionary")+"/api/v2/entries/fr/bonjour"); status != http.StatusNotFound {
+		t.Errorf("unrecorded path status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestServerMatchesQueries(t *testing.T) {
+	server := servicetest.NewServer()
+	defer server.Close()
+	_, search := get(t, server.UpstreamUrl("wikipedia")+"/w/api.php?action=query&list=search&srsearch=go")
+	_, info := get(t, server.UpstreamUrl("wikipedia")+"/w/api.php?action=query&prop=info&pageids=1")
+	if search == info {
+		t.Errorf("search and info got the same fixture, want the one matching their query")
+	}
+	if status, _ := get(t, server.UpstreamUrl("wikipedia")+"/w/api.php?action=query"); status != http.StatusNotFound {
+		t.Errorf("unmatched query status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestServerHandle(t *testing.T) {
+	server := servicetest.NewServer()
+	defer server.Close()
+	server.Handle(servicetest.Fixture{Upstream: "dadjoke", Path: "/", Status: http.StatusOK, ContentType: "text/plain", Body: []byte("replaced")})
+	if _, body := get(t, server.UpstreamUrl("dadjoke")); body != "replaced" {
+		t.Errorf("dadjoke = %q, want the fixture handled last", body)
+	}
+	server.Handle(servicetest.EmptyFixtures()...)
+	if status, body := get(t, server.UpstreamUrl("geocoding")+"/search?q=nowhere"); status != http.StatusOK || body != "[]" {
+		t.Errorf("geocoding = %d %q, want no result", status, body)
+	}
+}
+
+func TestServerFail(t *testing.T) {
+	server := servicetest.NewServer()
+	defer server.Close()
+	server.Fail("urban", http.StatusTooManyRequests)
+	for _, path := range []string{"", "/v0/define?term=yeet"} {
+		if status, _ := get(t, server.UpstreamUrl("urban")+path); status != http.StatusTooManyRequests {
+			t.Errorf("urban%s status = %d, want %d", path, status, http.StatusTooManyRequests)
+		}
+	}
+	if status, _ := get(t, server.UpstreamUrl("dadjoke")); status != http.StatusOK {
+		t.Errorf("dadjoke status = %d, want the other upstreams unaffected", status)
+	}
+}
+
+func TestServerRequests(t *testing.T) {
+	server := servicetest.NewServer()
+	defer server.Close()
+	if requests := server.Requests("urban"); len(requests) != 0 {
+		t.Fatalf("requests = %v before any, want none", requests)
+	}
+	get(t, server.UpstreamUrl("urban")+"/v0/define?term=yeet")
+	get(t, server.UpstreamUrl("urban")+"/v0/missing")
+	get(t, server.UpstreamUrl("dadjoke"))
+	requests := server.Requests("urban")
+	if len(requests) != 2 {
+		t.Fatalf("urban requests = %v, want 2", requests)
+	}
+	if requests[0].Path != "/v0/define" || requests[0].Query().Get("term") != "yeet" || requests[1].Path != "/v0/missing" {
+		t.Errorf("urban requests = %v, want /v0/define?term=yeet then /v0/missing relatively to the upstream", requests)
+	}
+	requests[0].Path = "/changed"
+	if server.Requests("urban")[0].Path != "/v0/define" {
+		t.Errorf("Requests() returned the requests recorded, want copies")
+	}
+}
+
+func TestServerExecutor(t *testing.T) {
+	server := servicetest.NewServer()
+	defer server.Close()
+	executor := server.Executor()
+	for _, upstream := range pkg.Upstreams() {
+		endpoint, err := url.Parse(executor.ApiKeys()[pkg.EndpointKey(upstream)])
+		if err != nil || endpoint.String() != server.UpstreamUrl(upstream) {
+			t.Errorf("%s endpoint = %v, want %s", upstream, endpoint, server.UpstreamUrl(upstream))
+		}
+	}
+	if executor.Trigger() != "!" || !executor.UserHasPermission(servicetest.NewUser("alice"), 0) {
+		t.Errorf("executor trigger %q, want ! and every permission granted", executor.Trigger())
+	}
+}
@@ -0,0 +1,52 @@
+package pkg
+
+import (
+	"github.com/raf924/connector-sdk/command"
+	"sync"
+)
+
+// metricsAddrKey is the ApiKeys entry enabling the metrics endpoint on the given address, e.g. "localhost:9100"
+const metricsAddrKey = "metrics_addr"
+
+var (
+	setUpOnce sync.Once
+	setUpErr  error
+)
+
+// setUp applies the settings shared by all the commands in pkg.
+// It is called by the Init of every command but only the first call, whichever the command, does anything.
+func setUp(executor command.Executor) error {
+	setUpOnce.Do(func() {
+		if rawPolicies := executor.ApiKeys()[channelPoliciesKey]; len(rawPolicies) > 0 {
+			executorPolicies, setUpErr = parseChannelPolicies(rawPolicies)
+			if setUpErr != nil {
+				return
+			}
+		}
+		configFileMu.Lock()
+		configFile = executor.ApiKeys()[configFileKey]
+		configFileMu.Unlock()
+		if setUpErr = loadConfig(configFile); setUpErr != nil {
+			return
+		}
+		if filename := executor.ApiKeys()[preferencesFileKey]; len(filename) > 0 {
+			if setUpErr = SetPreferencesFile(filename); setUpErr != nil {
+				return
+			}
+		}
+		if filename := executor.ApiKeys()[alertsFileKey]; len(filename) > 0 {
+			if setUpErr = SetAlertsFile(filename); setUpErr != nil {
+				return
+			}
+		}
+		if addr := executor.ApiKeys()[metricsAddrKey]; len(addr) > 0 {
+			if _, setUpErr = ServeMetrics(addr); setUpErr != nil {
+				return
+			}
+		}
+		if len(configFile) > 0 {
+			go watchConfig(configFile, configPollInterval)
+		}
+	})
+	return setUpErr
+}
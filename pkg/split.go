@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"github.com/raf924/connector-sdk/domain"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	defaultMaxMessageLength = 2000
+	defaultMaxMessages      = 3
+	moreHint                = " [more...]"
+)
+
+var (
+	replyLimitsLock  sync.RWMutex
+	maxMessageLength = defaultMaxMessageLength
+	maxMessages      = defaultMaxMessages
+)
+
+// SetReplyLimits sets the length in bytes above which a reply is split in several messages,
+// and how many messages a reply can be split into before being cut
+func SetReplyLimits(maxLength int, maxCount int) {
+	replyLimitsLock.Lock()
+	maxMessageLength = maxLength
+	maxMessages = maxCount
+	replyLimitsLock.Unlock()
+}
+
+func replyLimits() (int, int) {
+	replyLimitsLock.RLock()
+	defer replyLimitsLock.RUnlock()
+	return maxMessageLength, maxMessages
+}
+
+// truncate cuts text to at most maxLength bytes without breaking a rune
+func truncate(text string, maxLength int) string {
+	if len(text) <= maxLength {
+		return text
+	}
+	end := maxLength
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return text[:end]
+}
+
+// cutIndex returns where to cut text so that its first part is at most maxLength bytes long,
+// preferring line boundaries, then sentence boundaries, then word boundaries
+func cutIndex(text string, maxLength int) int {
+	window := truncate(text, maxLength)
+	if i := strings.LastIndex(window, "\n"); i > 0 {
+		return i + 1
+	}
+	sentenceEnd := -1
+	for _, separator := range []string{". ", "! ", "? "} {
+		if i := strings.LastIndex(window, separator); i > sentenceEnd {
+			sentenceEnd = i
+		}
+	}
+	if sentenceEnd > 0 {
+		return sentenceEnd + 2
+	}
+	if i := strings.LastIndex(window, " "); i > 0 {
+		return i + 1
+	}
+	if len(window) == 0 {
+		// maxLength is smaller than the first rune
+		_, size := utf8.DecodeRuneInString(text)
+		return size
+	}
+	return len(window)
+}
+
+// splitMessage splits text in at most maxCount parts of at most maxLength bytes,
+// the last part ending with moreHint if text had to be cut
+func splitMessage(text string, maxLength int, maxCount int) []string {
+	var parts []string
+	text = strings.TrimSpace(text)
+	for len(text) > 0 {
+		if len(text) <= maxLength {
+			parts = append(parts, text)
+			break
+		}
+		if len(parts) == maxCount-1 {
+			cut := cutIndex(text, maxLength-len(moreHint))
+			parts = append(parts, strings.TrimSpace(text[:cut])+moreHint)
+			break
+		}
+		cut := cutIndex(text, maxLength)
+		if part := strings.TrimSpace(text[:cut]); len(part) > 0 {
+			parts = append(parts, part)
+		}
+		text = strings.TrimSpace(text[cut:])
+	}
+	return parts
+}
+
+// limitReplies splits the messages of a reply that are too long and cuts those that would take too many messages
+func limitReplies(next handler) handler {
+	return func(inv *invocation) ([]*domain.ClientMessage, error) {
+		messages, err := next(inv)
+		if err != nil {
+			return messages, err
+		}
+		maxLength, maxCount := replyLimits()
+		if maxLength <= len(moreHint) || maxCount <= 0 {
+			return messages, nil
+		}
+		var limited []*domain.ClientMessage
+		for _, message := range messages {
+			if len(message.Message()) <= maxLength {
+				limited = append(limited, message)
+				continue
+			}
+			for _, part := range splitMessage(message.Message(), maxLength, maxCount) {
+				limited = append(limited, domain.NewClientMessage(part, message.Recipient(), message.Private()))
+			}
+		}
+		return limited, nil
+	}
+}
@@ -0,0 +1,43 @@
+package pkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxLength int
+		maxCount  int
+		want      []string
+	}{
+		{"short", "hello", 20, 3, []string{"hello"}},
+		{"lines", "first line\nsecond line", 15, 3, []string{"first line", "second line"}},
+		{"sentences", "One sentence. Another one.", 20, 3, []string{"One sentence.", "Another one."}},
+		{"words", "some words to split", 10, 3, []string{"some", "words to", "split"}},
+		{"cut", "one two three four five six seven eight", 16, 2, []string{"one two three", "four [more...]"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := splitMessage(test.text, test.maxLength, test.maxCount); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("splitMessage() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitMessageKeepsRunes(t *testing.T) {
+	text := strings.Repeat("é", 10)
+	for _, part := range splitMessage(text, 5, 10) {
+		if len(part) > 5 || !utf8.ValidString(part) {
+			t.Errorf("part %q, want at most 5 bytes of whole runes", part)
+		}
+	}
+	if got := truncate("été", 2); got != "é" {
+		t.Errorf("truncate() = %q, want é", got)
+	}
+}
@@ -0,0 +1,33 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestStatusCommand(t *testing.T) {
+	_, executor := newServer(t)
+	urban, status := &pkg.UrbanCommand{}, &pkg.StatusCommand{}
+	initCommand(t, urban, executor)
+	initCommand(t, status, executor)
+	alice := servicetest.NewUser("alice")
+	texts := run(t, status, alice, "urban", false)
+	if available := regexp.MustCompile(`^Status of urban:\nurban: available \(\d+ms\)$`); len(texts) != 1 || !available.MatchString(texts[0]) {
+		t.Errorf("texts = %q, want urban available", texts)
+	}
+	assertTexts(t, run(t, status, alice, "help", false), "help relies on no external service")
+	assertTexts(t, run(t, status, alice, "weather", false), "Unknown command \"weather\", use !help to list them")
+}
+
+func TestStatusCommandUnavailable(t *testing.T) {
+	server, executor := newServer(t)
+	server.Fail("urban", http.StatusServiceUnavailable)
+	urban, status := &pkg.UrbanCommand{}, &pkg.StatusCommand{}
+	initCommand(t, urban, executor)
+	initCommand(t, status, executor)
+	assertTexts(t, run(t, status, servicetest.NewUser("alice"), "urban", false),
+		"Status of urban:\nurban: unavailable: request status code: 503: 503 Service Unavailable")
+}
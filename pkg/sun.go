@@ -0,0 +1,183 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/raf924/connector-sdk/command"
+	"github.com/raf924/connector-sdk/domain"
+	"math"
+	"time"
+)
+
+var _ command.Command = (*SunCommand)(nil)
+var _ Helper = (*SunCommand)(nil)
+var _ ContextExecutable = (*SunCommand)(nil)
+
+const (
+	// julianUnixEpoch is the Julian date of the Unix epoch
+	julianUnixEpoch = 2440587.5
+	// julian2000 is the Julian date of 2000-01-01 12:00 UTC, from which the sunrise equation counts days
+	julian2000 = 2451545.0
+	// earthTilt is the obliquity of the ecliptic, in degrees
+	earthTilt = 23.4397
+	// sunriseAltitude is the altitude of the center of the sun at sunrise and sunset, accounting for refraction and its radius
+	sunriseAltitude = -0.833
+)
+
+// daylight is when the sun rises and sets on a day
+type daylight struct {
+	sunrise time.Time
+	sunset  time.Time
+	// polarDay and polarNight are set when the sun does not set, or rise, that day
+	polarDay   bool
+	polarNight bool
+}
+
+// length is how long the sun is up on the day
+func (d daylight) length() time.Duration {
+	switch {
+	case d.polarDay:
+		return 24 * time.Hour
+	case d.polarNight:
+		return 0
+	}
+	return d.sunset.Sub(d.sunrise)
+}
+
+// describe tells when the sun rises and sets, in the time zone of the times of d
+func (d daylight) describe() string {
+	switch {
+	case d.polarDay:
+		return "does not set today (polar day)"
+	case d.polarNight:
+		return "does not rise today (polar night)"
+	}
+	length := d.length().Round(time.Minute)
+	return fmt.Sprintf("rises at %s, sets at %s, %dh%02dm of daylight",
+		d.sunrise.Format("15:04"), d.sunset.Format("15:04"), int(length.Hours()), int(length.Minutes())%60)
+}
+
+func sinDegrees(degrees float64) float64 {
+	return math.Sin(degrees * math.Pi / 180)
+}
+
+func cosDegrees(degrees float64) float64 {
+	return math.Cos(degrees * math.Pi / 180)
+}
+
+func julianToTime(julian float64, location *time.Location) time.Time {
+	seconds := (julian - julianUnixEpoch) * 86400
+	return time.Unix(0, int64(seconds*float64(time.Second))).In(location).Round(time.Second)
+}
+
+// sunTimes computes the sunrise and the sunset on the day of date, in its time zone, with the sunrise equation.
+// They are accurate to a minute or two, which is all the commands show.
+func sunTimes(date time.Time, latitude float64, longitude float64) daylight {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, time.UTC)
+	n := math.Round(day.Sub(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)).Hours() / 24)
+	// meanNoon is the mean solar noon at the longitude, in days since julian2000
+	meanNoon := n - longitude/360
+	meanAnomaly := math.Mod(357.5291+0.98560028*meanNoon, 360)
+	center := 1.9148*sinDegrees(meanAnomaly) + 0.02*sinDegrees(2*meanAnomaly) + 0.0003*sinDegrees(3*meanAnomaly)
+	eclipticLongitude := math.Mod(meanAnomaly+center+180+102.9372, 360)
+	transit := julian2000 + meanNoon + 0.0053*sinDegrees(meanAnomaly) - 0.0069*sinDegrees(2*eclipticLongitude)
+	sinDeclination := sinDegrees(eclipticLongitude) * sinDegrees(earthTilt)
+	cosDeclination := math.Cos(math.Asin(sinDeclination))
+	cosHourAngle := (sinDegrees(sunriseAltitude) - sinDegrees(latitude)*sinDeclination) / (cosDegrees(latitude) * cosDeclination)
+	switch {
+	case cosHourAngle < -1:
+		return daylight{polarDay: true}
+	case cosHourAngle > 1:
+		return daylight{polarNight: true}
+	}
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+	return daylight{
+		sunrise: julianToTime(transit-hourAngle/360, date.Location()),
+		sunset:  julianToTime(transit+hourAngle/360, date.Location()),
+	}
+}
+
+// estimatedZone is the time zone of the nautical time at longitude, for when the time API cannot tell the actual one
+func estimatedZone(longitude float64) *time.Location {
+	offset := int(math.Round(longitude / 15))
+	return time.FixedZone(fmt.Sprintf("UTC%+d", offset), offset*3600)
+}
+
+// SunCommand tells when the sun rises and sets in a city.
+// The times are computed locally, the time API only giving the time zone, which is estimated from the longitude when it cannot.
+type SunCommand struct {
+	WeatherCommand
+}
+
+func (s *SunCommand) Init(executor command.Executor) error {
+	return s.init(executor)
+}
+
+func (s *SunCommand) Name() string {
+	return "sun"
+}
+
+func (s *SunCommand) Aliases() []string {
+	return []string{"sunrise", "sunset"}
+}
+
+func (s *SunCommand) Usage() string {
+	return "<city>"
+}
+
+func (s *SunCommand) Description() string {
+	return "Tells when the sun rises and sets today in a city, and how long the day is"
+}
+
+func (s *SunCommand) Examples() []string {
+	return []string{"reykjavik"}
+}
+
+func (s *SunCommand) OnChat(message *domain.ChatMessage) ([]*domain.ClientMessage, error) {
+	return s.NoOpInterceptor.OnChat(message)
+}
+
+func (s *SunCommand) upstreams() []string {
+	return []string{geocodingUpstream, timeApiUpstream}
+}
+
+func (s *SunCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	return execute(s, command)
+}
+
+func (s *SunCommand) ExecuteContext(ctx context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	args, err := parseArgs(command.ArgString())
+	if err != nil {
+		return nil, err
+	}
+	city := args.text()
+	if len(city) == 0 {
+		city = preferencesOf(command.Sender()).Location
+	}
+	if len(city) == 0 {
+		return nil, badInput("Which city? e.g. %s paris, or set a default one with %sset location paris", s.Name(), s.trigger)
+	}
+	location, err := s.fetchLocation(ctx, city)
+	if err != nil {
+		return nil, err
+	}
+	zoneNote := ""
+	locationTime, err := s.fetchLocationTime(ctx, location.latitude, location.longitude)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		loggerFrom(ctx).Warn("estimating the time zone from the longitude", "err", err)
+		zone := estimatedZone(location.longitude)
+		locationTime = time.Now().In(zone)
+		zoneNote = fmt.Sprintf(" (%s, estimated)", zone)
+	}
+	sun := sunTimes(locationTime, location.latitude, location.longitude)
+	return []*domain.ClientMessage{
+		domain.NewClientMessage(
+			Reply{Text(fmt.Sprintf("In %s, %s, the sun %s%s", location.name, location.country, sun.describe(), zoneNote))}.Render(s.renderer),
+			command.Sender(),
+			command.Private(),
+		),
+	}, nil
+}
@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+// almanacTolerance is how far sunTimes may be from the almanac, which is more than the rounding of both to the minute
+const almanacTolerance = 2 * time.Minute
+
+func TestSunTimes(t *testing.T) {
+	tests := []struct {
+		name      string
+		date      time.Time
+		latitude  float64
+		longitude float64
+		sunrise   string
+		sunset    string
+	}{
+		{"paris", time.Date(2026, 10, 18, 10, 0, 0, 0, time.FixedZone("CEST", 2*3600)), 48.8566, 2.3522, "08:15", "18:55"},
+		{"london solstice", time.Date(2000, 6, 21, 10, 0, 0, 0, time.FixedZone("BST", 3600)), 51.5074, -0.1278, "04:43", "21:21"},
+		{"wellington", time.Date(2026, 10, 18, 10, 0, 0, 0, time.FixedZone("NZDT", 13*3600)), -41.2865, 174.7762, "06:28", "19:44"},
+		{"new york", time.Date(2026, 1, 15, 10, 0, 0, 0, time.FixedZone("EST", -5*3600)), 40.7128, -74.0060, "07:18", "16:53"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sun := sunTimes(test.date, test.latitude, test.longitude)
+			if sun.polarDay || sun.polarNight {
+				t.Fatalf("sunTimes() = %+v, want a sunrise and a sunset", sun)
+			}
+			for _, check := range []struct {
+				event string
+				got   time.Time
+				want  string
+			}{{"sunrise", sun.sunrise, test.sunrise}, {"sunset", sun.sunset, test.sunset}} {
+				clock, _ := time.Parse("15:04", check.want)
+				want := time.Date(test.date.Year(), test.date.Month(), test.date.Day(), clock.Hour(), clock.Minute(), 0, 0, test.date.Location())
+				if diff := check.got.Sub(want); diff < -almanacTolerance || diff > almanacTolerance {
+					t.Errorf("%s = %s, want %s within %s", check.event, check.got.Format("15:04:05"), check.want, almanacTolerance)
+				}
+			}
+		})
+	}
+}
+
+func TestSunTimesPolar(t *testing.T) {
+	tromso := func(month time.Month) time.Time { return time.Date(2026, month, 21, 12, 0, 0, 0, time.UTC) }
+	if sun := sunTimes(tromso(time.June), 69.6492, 18.9553); !sun.polarDay {
+		t.Errorf("sunTimes() in June = %+v, want a polar day", sun)
+	}
+	if sun := sunTimes(tromso(time.December), 69.6492, 18.9553); !sun.polarNight {
+		t.Errorf("sunTimes() in December = %+v, want a polar night", sun)
+	}
+}
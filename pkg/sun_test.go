@@ -0,0 +1,29 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSunCommand(t *testing.T) {
+	_, executor := newServer(t)
+	sun := &pkg.SunCommand{}
+	initCommand(t, sun, executor)
+	assertTexts(t, run(t, sun, servicetest.NewUser("alice"), "paris", false),
+		"In Paris, France, the sun rises at 08:14, sets at 18:56, 10h42m of daylight")
+}
+
+func TestSunCommandEstimatesZone(t *testing.T) {
+	server, executor := newServer(t)
+	server.Fail("timeapi", http.StatusServiceUnavailable)
+	sun := &pkg.SunCommand{}
+	initCommand(t, sun, executor)
+	// the date is today's then, the sun times depending on it
+	texts := run(t, sun, servicetest.NewUser("alice"), "paris", false)
+	if len(texts) != 1 || !strings.HasPrefix(texts[0], "In Paris, France, the sun rises at ") || !strings.HasSuffix(texts[0], " of daylight (UTC+0, estimated)") {
+		t.Errorf("texts = %q, want the sun times in the estimated UTC+0 zone", texts)
+	}
+}
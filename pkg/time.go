@@ -1,17 +1,24 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
 )
 
 var _ command.Command = (*TimeCommand)(nil)
+var _ Helper = (*TimeCommand)(nil)
+var _ ContextExecutable = (*TimeCommand)(nil)
 
 type TimeCommand struct {
 	WeatherCommand
 }
 
+func (t *TimeCommand) Init(executor command.Executor) error {
+	return t.init(executor)
+}
+
 func (t *TimeCommand) Name() string {
 	return "time"
 }
@@ -20,21 +27,53 @@ func (t *TimeCommand) Aliases() []string {
 	return []string{"t"}
 }
 
+func (t *TimeCommand) Usage() string {
+	return "<city>"
+}
+
+func (t *TimeCommand) Description() string {
+	return "Tells the local time in a city and when the sun rises and sets there"
+}
+
+func (t *TimeCommand) Examples() []string {
+	return []string{"tokyo"}
+}
+
+func (t *TimeCommand) OnChat(message *domain.ChatMessage) ([]*domain.ClientMessage, error) {
+	return t.NoOpInterceptor.OnChat(message)
+}
+
+func (t *TimeCommand) upstreams() []string {
+	return []string{geocodingUpstream, timeApiUpstream}
+}
+
 func (t *TimeCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
-	if len(command.Args()) == 0 {
-		return nil, fmt.Errorf("missing arguments")
+	return execute(t, command)
+}
+
+func (t *TimeCommand) ExecuteContext(ctx context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	args, err := parseArgs(command.ArgString())
+	if err != nil {
+		return nil, err
+	}
+	city := args.text()
+	if len(city) == 0 {
+		city = preferencesOf(command.Sender()).Location
+	}
+	if len(city) == 0 {
+		return nil, badInput("Which city? e.g. %s paris, or set a default one with %sset location paris", t.Name(), t.trigger)
 	}
-	location, err := t.fetchLocation(command.ArgString())
+	location, err := t.fetchLocation(ctx, city)
 	if err != nil {
 		return nil, err
 	}
-	locationTime, err := t.fetchLocationTime(location.latitude, location.longitude)
+	locationTime, err := t.fetchLocationTime(ctx, location.latitude, location.longitude)
 	if err != nil {
 		return nil, err
 	}
 	return []*domain.ClientMessage{
 		domain.NewClientMessage(
-			fmt.Sprintf("%s - %s, %s", locationTime.Format("03:04:04 PM"), location.name, location.country),
+			Reply{Text(fmt.Sprintf("%s - %s, %s, the sun %s", locationTime.Format("03:04:05 PM"), location.name, location.country, sunTimes(locationTime, location.latitude, location.longitude).describe()))}.Render(t.renderer),
 			command.Sender(),
 			command.Private(),
 		),
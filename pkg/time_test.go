@@ -0,0 +1,28 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"net/http"
+	"testing"
+)
+
+func TestTimeCommand(t *testing.T) {
+	server, executor := newServer(t)
+	timeCommand := &pkg.TimeCommand{}
+	initCommand(t, timeCommand, executor)
+	assertTexts(t, run(t, timeCommand, servicetest.NewUser("alice"), "paris", false),
+		"10:30:00 AM - Paris, France, the sun rises at 08:14, sets at 18:56, 10h42m of daylight")
+	if requests := server.Requests("geocoding"); len(requests) != 1 || requests[0].Query().Get("q") != "paris" {
+		t.Errorf("geocoding requests = %v, want paris searched once", requests)
+	}
+}
+
+func TestTimeCommandUnavailable(t *testing.T) {
+	server, executor := newServer(t)
+	server.Fail("timeapi", http.StatusServiceUnavailable)
+	timeCommand := &pkg.TimeCommand{}
+	initCommand(t, timeCommand, executor)
+	assertTexts(t, run(t, timeCommand, servicetest.NewUser("alice"), "paris", false),
+		"timeapi is unavailable right now, please try again later")
+}
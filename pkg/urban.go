@@ -1,18 +1,24 @@
 package pkg
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
-	"math"
-	"net/http"
 	"net/url"
-	"strings"
+	"sync/atomic"
 	"time"
 )
 
 var _ command.Command = (*UrbanCommand)(nil)
+var _ Helper = (*UrbanCommand)(nil)
+var _ ContextExecutable = (*UrbanCommand)(nil)
+
+const (
+	urbanTimeout  = 10 * time.Second
+	urbanCacheTTL = 24 * time.Hour
+	// definitions can be lengthy essays, the beginning is enough
+	urbanMaxLength = 500
+)
 
 type urbanData struct {
 	Definition string `json:"definition"`
@@ -23,19 +29,33 @@ type urbanResponse struct {
 	List []urbanData `json:"list"`
 }
 
+// urbanSettings are the settings of UrbanCommand coming from the Config
+type urbanSettings struct {
+	urbanUrl *url.URL
+	// maxLength is the length above which definitions are cut
+	maxLength int
+}
+
 type UrbanCommand struct {
 	command.NoOpInterceptor
-	urbanRequest *http.Request
+	current  atomic.Value
+	client   *httpClient
+	renderer Renderer
+	trigger  string
 }
 
-func (u *UrbanCommand) Init(command.Executor) error {
-	urbanURL, _ := url.Parse("http://api.urbandictionary.com/v0/define")
-	urbanRequest, err := http.NewRequest("GET", urbanURL.String(), nil)
+func (u *UrbanCommand) Init(executor command.Executor) error {
+	if err := setUp(executor); err != nil {
+		return err
+	}
+	var err error
+	u.client = newHttpClient(urbanTimeout, defaultMaxBodySize)
+	u.trigger = executor.Trigger()
+	u.renderer, err = rendererFor(executor)
 	if err != nil {
 		return err
 	}
-	u.urbanRequest = urbanRequest
-	return nil
+	return configureCommand(u, executor)
 }
 
 func (u *UrbanCommand) Name() string {
@@ -46,31 +66,74 @@ func (u *UrbanCommand) Aliases() []string {
 	return []string{"u"}
 }
 
+func (u *UrbanCommand) Usage() string {
+	return "<term>"
+}
+
+func (u *UrbanCommand) Description() string {
+	return "Defines a slang term with Urban Dictionary"
+}
+
+func (u *UrbanCommand) Examples() []string {
+	return []string{"yeet"}
+}
+
+func (u *UrbanCommand) configure(config commandConfig) (func(), error) {
+	baseUrl, err := config.endpoint(urbanUpstream)
+	if err != nil {
+		return nil, err
+	}
+	settings := &urbanSettings{urbanUrl: endpointUrl(baseUrl, "v0", "define"), maxLength: config.Urban.MaxLength}
+	return func() { u.current.Store(settings) }, nil
+}
+
+func (u *UrbanCommand) settings() *urbanSettings {
+	return u.current.Load().(*urbanSettings)
+}
+
+func (u *UrbanCommand) upstreams() []string {
+	return []string{urbanUpstream}
+}
+
 func (u *UrbanCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
-	urbanRequest := *u.urbanRequest
-	urbanURL := *urbanRequest.URL
-	urbanQuery := urbanURL.Query()
-	urbanQuery.Set("term", strings.Join(command.Args(), "+"))
-	urbanURL.RawQuery = urbanQuery.Encode()
-	urbanRequest.URL = &urbanURL
-	netClient := http.Client{Timeout: time.Second * 30}
-	response, err := netClient.Do(&urbanRequest)
+	return execute(u, command)
+}
+
+func (u *UrbanCommand) ExecuteContext(ctx context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	args, err := parseArgs(command.ArgString())
 	if err != nil {
 		return nil, err
 	}
+	term := args.text()
+	if len(term) == 0 {
+		return nil, badInput("Which term should I define?")
+	}
+	settings := u.settings()
+	urbanURL := *settings.urbanUrl
+	urbanQuery := urbanURL.Query()
+	urbanQuery.Set("term", term)
+	urbanURL.RawQuery = urbanQuery.Encode()
 	var urbanResponse urbanResponse
-	err = json.NewDecoder(response.Body).Decode(&urbanResponse)
+	err = cached(cacheKey(urbanUpstream, term), urbanCacheTTL, &urbanResponse, func() error {
+		return u.client.getJSON(ctx, urbanURL.String(), &urbanResponse)
+	})
 	if err != nil {
-		return nil, err
+		return nil, upstreamError(urbanUpstream, err)
 	}
 	if len(urbanResponse.List) == 0 {
-		return nil, nil
+		return nil, notFound("No definition found for %q", term)
+	}
+	var definitions []Reply
+	for _, data := range urbanResponse.List {
+		definitions = append(definitions, Reply{
+			Text(truncate(data.Definition, settings.maxLength)),
+			Link{Url: data.PermaLink},
+		})
 	}
-	definition := urbanResponse.List[0].Definition
-	size := int(math.Min(500, float64(len(definition))))
+	reply := paginate(command, u.trigger, definitions[0], staticPages(definitions[1:]))
 	return []*domain.ClientMessage{
 		domain.NewClientMessage(
-			fmt.Sprintf("%s - %s", urbanResponse.List[0].Definition[0:size], urbanResponse.List[0].PermaLink),
+			reply.Render(u.renderer),
 			command.Sender(),
 			command.Private(),
 		),
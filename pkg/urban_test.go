@@ -0,0 +1,28 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"testing"
+)
+
+func TestUrbanCommand(t *testing.T) {
+	server, executor := newServer(t)
+	urban := &pkg.UrbanCommand{}
+	initCommand(t, urban, executor)
+	assertTexts(t, run(t, urban, servicetest.NewUser("alice"), "yeet", false),
+		"The act of writing code in [Go] while pretending it is simple.\n"+
+			"http://gopher.urbanup.com/1\n"+
+			"(1 more, use !more)")
+	if requests := server.Requests("urban"); len(requests) != 1 || requests[0].Query().Get("term") != "yeet" {
+		t.Errorf("urban requests = %v, want yeet defined once", requests)
+	}
+}
+
+func TestUrbanCommandNotFound(t *testing.T) {
+	server, executor := newServer(t)
+	server.Handle(servicetest.EmptyFixtures()...)
+	urban := &pkg.UrbanCommand{}
+	initCommand(t, urban, executor)
+	assertTexts(t, run(t, urban, servicetest.NewUser("alice"), "zzzz", false), "No definition found for \"zzzz\"")
+}
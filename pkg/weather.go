@@ -1,23 +1,36 @@
 package pkg
 
 import (
+	"context"
 	_ "embed"
-	"encoding/json"
 	"fmt"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
 	"math"
-	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var _ command.Command = (*WeatherCommand)(nil)
+var _ Helper = (*WeatherCommand)(nil)
+var _ ContextExecutable = (*WeatherCommand)(nil)
+
+// watchAlertsOnce starts checking the alerts with the first WeatherCommand initialized
+var watchAlertsOnce sync.Once
 
 const defaultDegreeType = Metrics
 
+const weatherTimeout = 10 * time.Second
+
+const (
+	locationCacheTTL = 7 * 24 * time.Hour
+	forecastCacheTTL = 10 * time.Minute
+)
+
 type timeResponse struct {
 	TimeZone         string `json:"timeZone"`
 	CurrentLocalTime string `json:"currentLocalTime"`
@@ -40,72 +53,67 @@ type geocodingResponse struct {
 	Importance  float64  `json:"importance"`
 }
 
-type weatherResponse struct {
-	Cnt  int `json:"cnt"`
-	List []struct {
-		Dt   int64 `json:"dt"`
-		Main struct {
-			Temp      float64 `json:"temp"`
-			FeelsLike float64 `json:"feels_like"`
-			TempMin   float64 `json:"temp_min"`
-			TempMax   float64 `json:"temp_max"`
-			Pressure  int     `json:"pressure"`
-			SeaLevel  int     `json:"sea_level"`
-			GrndLevel int     `json:"grnd_level"`
-			Humidity  int     `json:"humidity"`
-			TempKf    float64 `json:"temp_kf"`
-		} `json:"main"`
-		Weather []struct {
-			Id          int    `json:"id"`
-			Main        string `json:"main"`
-			Description string `json:"description"`
-			Icon        string `json:"icon"`
-		} `json:"weather"`
-		Clouds struct {
-			All int `json:"all"`
-		} `json:"clouds"`
-		Wind struct {
-			Speed float64 `json:"speed"`
-			Deg   int     `json:"deg"`
-			Gust  float64 `json:"gust"`
-		} `json:"wind"`
-		Visibility int     `json:"visibility"`
-		Pop        float64 `json:"pop"`
-		Sys        struct {
-			Pod string `json:"pod"`
-		} `json:"sys"`
-		DtTxt string `json:"dt_txt"`
-	} `json:"list"`
-	City struct {
-		Id    int    `json:"id"`
-		Name  string `json:"name"`
-		Coord struct {
-			Lat float64 `json:"lat"`
-			Lon float64 `json:"lon"`
-		} `json:"coord"`
-		Country    string `json:"country"`
-		Population int    `json:"population"`
-		Timezone   int    `json:"timezone"`
-		Sunrise    int    `json:"sunrise"`
-		Sunset     int    `json:"sunset"`
-	} `json:"city"`
+type degree string
+
+var weatherOptions = []commandOption{
+	{name: "units", short: "u", choices: []string{"metric", "imperial"}},
+	{name: "hourly", kind: boolOption},
+	{name: "details", short: "d", kind: boolOption},
 }
 
-type degree string
+const (
+	// defaultHourlyHours is how far the hourly forecast looks when no number of hours is given
+	defaultHourlyHours = 12
+	maxHourlyHours     = 48
+	// maxHourlySlots keeps the hourly forecast compact, slots being skipped evenly beyond it
+	maxHourlySlots = 12
+)
 
 const (
 	Metrics  degree = "C"
 	Imperial degree = "F"
 )
 
-func (d degree) convert(temperatureKelvin float64) float64 {
-	switch d {
-	case Metrics:
-		return temperatureKelvin - 273.15
-	case Imperial:
-		return temperatureKelvin*9/5 - 459.67
+func (d degree) convert(temperatureCelsius float64) float64 {
+	if d == Imperial {
+		return temperatureCelsius*9/5 + 32
 	}
-	return temperatureKelvin
+	return temperatureCelsius
+}
+
+// speed converts a speed in m/s to km/h or mph
+func (d degree) speed(metersPerSecond float64) string {
+	if d == Imperial {
+		return fmt.Sprintf("%0.0f mph", metersPerSecond*2.236936)
+	}
+	return fmt.Sprintf("%0.0f km/h", metersPerSecond*3.6)
+}
+
+// distance converts a distance in meters to km or miles
+func (d degree) distance(meters float64) string {
+	if d == Imperial {
+		return fmt.Sprintf("%0.1f mi", meters/1609.344)
+	}
+	return fmt.Sprintf("%0.1f km", meters/1000)
+}
+
+// pressure converts a pressure in hPa to inches of mercury in imperial units
+func (d degree) pressure(hectopascals float64) string {
+	if d == Imperial {
+		return fmt.Sprintf("%0.2f inHg", hectopascals*0.02953)
+	}
+	return fmt.Sprintf("%0.0f hPa", hectopascals)
+}
+
+var compassPoints = []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+
+// compassDirection returns the point of the compass closest to degrees, e.g. 237 is SW
+func compassDirection(degrees float64) string {
+	sector := int(math.Floor(math.Mod(degrees, 360)/22.5+0.5)) % len(compassPoints)
+	if sector < 0 {
+		sector += len(compassPoints)
+	}
+	return compassPoints[sector]
 }
 
 type location struct {
@@ -115,68 +123,94 @@ type location struct {
 	longitude float64
 }
 
-type weatherForDay struct {
-	temperature float64
-	sky         string
-	min         float64
-	max         float64
-	day         string
-}
-
-type forecast struct {
-	current       weatherForDay
-	followingDays []*weatherForDay
-	location      string
+// weatherSettings are the settings of WeatherCommand coming from the Config
+type weatherSettings struct {
+	// providers are tried in order until one of them gives a forecast
+	providers    []WeatherProvider
+	geocodingApi *url.URL
+	timeApi      *url.URL
+	// units are the default unit system, metric or imperial
+	units string
+	// alertInterval is how often the locations channels subscribed to are checked
+	alertInterval time.Duration
 }
 
 type WeatherCommand struct {
 	command.NoOpInterceptor
-	baseUrl *url.URL
-	apiKey  string
+	current  atomic.Value
+	client   *httpClient
+	renderer Renderer
+	trigger  string
+	executor command.Executor
 }
 
 func (w *WeatherCommand) geocodingUrl(search string) *url.URL {
-	baseUrl, _ := url.Parse("https://geocode.maps.co/search")
+	baseUrl := endpointUrl(w.settings().geocodingApi, "search")
 	query := baseUrl.Query()
 	query.Set("q", search)
 	baseUrl.RawQuery = query.Encode()
 	return baseUrl
 }
 
-func (w *WeatherCommand) weatherUrl(latitude float64, longitude float64) *url.URL {
-	baseUrl, _ := w.baseUrl.Parse("/data/2.5/forecast")
-	query := baseUrl.Query()
-	query.Set("lat", strconv.FormatFloat(latitude, 'f', 5, 64))
-	query.Set("lon", strconv.FormatFloat(longitude, 'f', 5, 64))
-	query.Set("appid", w.apiKey)
-	baseUrl.RawQuery = query.Encode()
-	return baseUrl
-}
-
-func (w *WeatherCommand) fetchLocationTime(latitude float64, longitude float64) (time.Time, error) {
-	timeUrl, _ := url.Parse("https://www.timeapi.io/api/TimeZone/coordinate")
+func (w *WeatherCommand) fetchLocationTime(ctx context.Context, latitude float64, longitude float64) (time.Time, error) {
+	timeUrl := endpointUrl(w.settings().timeApi, "api", "TimeZone", "coordinate")
 	query := timeUrl.Query()
 	query.Set("latitude", strconv.FormatFloat(latitude, 'f', 15, 64))
 	query.Set("longitude", strconv.FormatFloat(longitude, 'f', 15, 64))
 	timeUrl.RawQuery = query.Encode()
-	response, err := http.Get(timeUrl.String())
-	if err != nil {
-		return time.Time{}, err
-	}
 	var timeR timeResponse
-	err = json.NewDecoder(response.Body).Decode(&timeR)
+	err := w.client.getJSON(ctx, timeUrl.String(), &timeR)
 	if err != nil {
-		return time.Time{}, err
+		return time.Time{}, upstreamError(timeApiUpstream, err)
 	}
 	location := time.FixedZone(timeR.TimeZone, timeR.CurrentUtcOffset.Seconds)
 	return time.ParseInLocation("2006-01-02T15:04:05", timeR.CurrentLocalTime, location)
 }
 
 func (w *WeatherCommand) Init(executor command.Executor) error {
+	if err := w.init(executor); err != nil {
+		return err
+	}
+	watchAlertsOnce.Do(func() { go w.watchAlerts() })
+	return nil
+}
+
+// init initializes w without checking the alerts, which the commands embedding WeatherCommand must not do too
+func (w *WeatherCommand) init(executor command.Executor) error {
+	if err := setUp(executor); err != nil {
+		return err
+	}
+	var err error
+	w.client = newHttpClient(weatherTimeout, defaultMaxBodySize)
+	w.trigger = executor.Trigger()
+	w.executor = executor
+	w.renderer, err = rendererFor(executor)
+	if err != nil {
+		return err
+	}
+	return configureCommand(w, executor)
+}
+
+func (w *WeatherCommand) configure(config commandConfig) (func(), error) {
+	settings := &weatherSettings{units: config.Weather.Units, alertInterval: time.Duration(config.Weather.AlertMinutes) * time.Minute}
 	var err error
-	w.apiKey = executor.ApiKeys()["openweather"]
-	w.baseUrl, err = url.Parse("https://api.openweathermap.org")
-	return err
+	settings.providers, err = weatherProviders(config.Weather.Providers, w.client, config)
+	if err != nil {
+		return nil, err
+	}
+	settings.geocodingApi, err = config.endpoint(geocodingUpstream)
+	if err != nil {
+		return nil, err
+	}
+	settings.timeApi, err = config.endpoint(timeApiUpstream)
+	if err != nil {
+		return nil, err
+	}
+	return func() { w.current.Store(settings) }, nil
+}
+
+func (w *WeatherCommand) settings() *weatherSettings {
+	return w.current.Load().(*weatherSettings)
 }
 
 func (w *WeatherCommand) Name() string {
@@ -187,29 +221,49 @@ func (w *WeatherCommand) Aliases() []string {
 	return []string{"w"}
 }
 
-func (w *WeatherCommand) fetchLocation(search string) (*location, error) {
-	geocodingUrl := w.geocodingUrl(search)
-	response, err := http.Get(geocodingUrl.String())
-	if err != nil {
-		return nil, err
+func (w *WeatherCommand) Usage() string {
+	return "<city> [c|f] [<n>h] " + optionsUsage(weatherOptions) + " | subscribe [<city>] | unsubscribe <city>"
+}
+
+func (w *WeatherCommand) Description() string {
+	return "Shows the current weather, in details if asked, and the forecast of the coming days, or of the coming hours, in a city, in Celsius or Fahrenheit. " +
+		"Subscribing a channel to a city has storms and heat there announced in it, in answer to its next message unless the bot is set up to send them right away. " +
+		"Only who subscribed, or a moderator, can unsubscribe a public channel"
+}
+
+func (w *WeatherCommand) Examples() []string {
+	return []string{"paris", "new york f", "--units=imperial \"san francisco\"", "--hourly london", "paris 24h", "--details berlin", "subscribe miami", "unsubscribe miami"}
+}
+
+func (w *WeatherCommand) upstreams() []string {
+	upstreams := []string{geocodingUpstream, timeApiUpstream}
+	for _, provider := range w.settings().providers {
+		upstreams = append(upstreams, provider.Name())
 	}
+	return upstreams
+}
+
+func (w *WeatherCommand) fetchLocation(ctx context.Context, search string) (*location, error) {
+	geocodingUrl := w.geocodingUrl(search)
 	var geocodingResponses []geocodingResponse
-	err = json.NewDecoder(response.Body).Decode(&geocodingResponses)
+	err := cached(cacheKey(geocodingUpstream, search), locationCacheTTL, &geocodingResponses, func() error {
+		return w.client.getJSON(ctx, geocodingUrl.String(), &geocodingResponses)
+	})
 	if err != nil {
-		return nil, err
+		return nil, upstreamError(geocodingUpstream, err)
 	}
 	if len(geocodingResponses) == 0 {
-		return nil, fmt.Errorf("incorrect output")
+		return nil, notFound("Could not find %q", search)
 	}
 	displayName := geocodingResponses[0].DisplayName
 	parts := strings.Split(displayName, ",")
 	lat, err := strconv.ParseFloat(geocodingResponses[0].Lat, 64)
 	if err != nil {
-		return nil, err
+		return nil, upstreamError(geocodingUpstream, err)
 	}
 	lon, err := strconv.ParseFloat(geocodingResponses[0].Lon, 64)
 	if err != nil {
-		return nil, err
+		return nil, upstreamError(geocodingUpstream, err)
 	}
 	return &location{
 		name:      parts[0],
@@ -219,93 +273,166 @@ func (w *WeatherCommand) fetchLocation(search string) (*location, error) {
 	}, nil
 }
 
-func atMidnight(t time.Time) time.Time {
-	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+func (w *WeatherCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	return execute(w, command)
 }
 
-func (w *WeatherCommand) fetchWeather(currentTime time.Time, latitude, longitude float64) (*forecast, error) {
-	weatherUrl := w.weatherUrl(latitude, longitude)
-	response, err := http.Get(weatherUrl.String())
-	if err != nil {
-		return nil, err
-	}
-	var weatherResponse weatherResponse
-	err = json.NewDecoder(response.Body).Decode(&weatherResponse)
+// OnChat delivers the alerts waiting for a message in the channel of message, when there is no alert sink.
+// TimeCommand and SunCommand embed WeatherCommand but override OnChat, so that the alerts are delivered only once.
+func (w *WeatherCommand) OnChat(message *domain.ChatMessage) ([]*domain.ClientMessage, error) {
+	return weatherAlerts.takePending(channelOf(message.Sender(), message.Private())), nil
+}
+
+func (w *WeatherCommand) ExecuteContext(ctx context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	args, err := parseArgs(command.ArgString(), weatherOptions...)
 	if err != nil {
 		return nil, err
 	}
-	f := forecast{}
-	currentWeather := weatherResponse.List[0]
-	f.current = weatherForDay{temperature: currentWeather.Main.Temp, sky: currentWeather.Weather[0].Description}
-	nextDay := time.Date(currentTime.Year(), currentTime.Month(), currentTime.Day()+1, 0, 0, 0, 0, currentTime.Location())
-	for _, ww := range weatherResponse.List {
-		nextDayUnix := nextDay.Unix()
-		if f.followingDays == nil && ww.Dt < nextDayUnix {
-			continue
-		}
-		forecastDay := atMidnight(time.Unix(ww.Dt, 0).In(currentTime.Location()))
-		if forecastDay.Unix() == nextDayUnix {
-			f.followingDays = append(f.followingDays, &weatherForDay{
-				temperature: 0,
-				sky:         "",
-				min:         math.MaxFloat64,
-				max:         0,
-				day:         nextDay.Weekday().String(),
-			})
-			nextDay = time.Date(nextDay.Year(), nextDay.Month(), nextDay.Day()+1, 0, 0, 0, 0, nextDay.Location())
+	if len(args.positional) > 0 {
+		if action := strings.ToLower(args.positional[0]); action == "subscribe" || action == "unsubscribe" {
+			reply, err := w.manageAlerts(ctx, command, action, args.positional[1:])
+			if err != nil {
+				return nil, err
+			}
+			return []*domain.ClientMessage{
+				domain.NewClientMessage(reply.Render(w.renderer), command.Sender(), command.Private()),
+			}, nil
 		}
-		followingDay := f.followingDays[len(f.followingDays)-1]
-		followingDay.min = math.Min(followingDay.min, ww.Main.TempMin)
-		followingDay.max = math.Max(followingDay.max, ww.Main.TempMax)
-		if !strings.HasSuffix(followingDay.sky, ww.Weather[0].Description) {
-			if followingDay.sky != "" {
-				followingDay.sky += " - "
+	}
+	prefs := preferencesOf(command.Sender())
+	city := args.positional
+	unitSystem := setting(ctx, "units", w.settings().units)
+	if len(prefs.Units) > 0 {
+		unitSystem = prefs.Units
+	}
+	hourly := args.bool("hourly")
+	hours := defaultHourlyHours
+	for len(city) > 0 {
+		// a trailing c or f is a shorthand for the units option, and a trailing number of hours, e.g. 12h, for the hourly one,
+		// even alone, e.g. "weather f" for the saved location
+		last := strings.ToLower(city[len(city)-1])
+		if last == "f" {
+			unitSystem = "imperial"
+		} else if last == "c" {
+			unitSystem = "metric"
+		} else if n, ok := parseHours(last); ok {
+			if n < 1 || n > maxHourlyHours {
+				return nil, badInput("The hourly forecast goes from 1h to %dh", maxHourlyHours)
 			}
-			followingDay.sky += ww.Weather[0].Description
+			hourly, hours = true, n
+		} else {
+			break
 		}
+		city = city[:len(city)-1]
 	}
-	f.followingDays = f.followingDays[:len(f.followingDays)-1]
-	return &f, nil
-}
-
-func (w *WeatherCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
-	if len(command.Args()) == 0 {
-		return nil, nil
-	}
-	args := command.Args()
-	lastArg := strings.ToLower(args[len(args)-1])
-	var units degree
-	switch strings.ToLower(lastArg) {
-	case "f":
-		units = Imperial
-		args = args[:len(args)-1]
-	case "c":
+	units := defaultDegreeType
+	switch strings.ToLower(args.string("units", unitSystem)) {
+	case "metric":
 		units = Metrics
-		args = args[:len(args)-1]
-	default:
-		units = defaultDegreeType
+	case "imperial":
+		units = Imperial
+	}
+	if len(city) == 0 && len(prefs.Location) > 0 {
+		city = []string{prefs.Location}
 	}
-	geoSearch := strings.Join(args, " ")
-	loc, err := w.fetchLocation(geoSearch)
+	if len(city) == 0 {
+		return nil, badInput("Which city? e.g. %s paris f, or set a default one with %sset location paris", w.Name(), w.trigger)
+	}
+	geoSearch := strings.Join(city, " ")
+	loc, err := w.fetchLocation(ctx, geoSearch)
 	if err != nil {
-		return nil, fmt.Errorf("get weather error: %s", err.Error())
+		return nil, err
 	}
 
-	locationTime, err := w.fetchLocationTime(loc.latitude, loc.longitude)
+	locationTime, err := w.fetchLocationTime(ctx, loc.latitude, loc.longitude)
 	if err != nil {
 		return nil, err
 	}
 
-	weather, err := w.fetchWeather(locationTime, loc.latitude, loc.longitude)
+	weather, err := forecastWithFallback(ctx, w.settings().providers, loc.latitude, loc.longitude, locationTime)
 	if err != nil {
 		return nil, err
 	}
 
-	text := fmt.Sprintf("Showing weather for %s, %s\nCurrent: %0.1f°%s - %s\n", loc.name, loc.country, units.convert(weather.current.temperature), units, weather.current.sky)
-	for _, followingDay := range weather.followingDays {
-		text += fmt.Sprintf("%s: %0.1f°%s to %0.1f°%s -- %s\n", followingDay.day, units.convert(followingDay.min), units, units.convert(followingDay.max), units, followingDay.sky)
+	if hourly {
+		return []*domain.ClientMessage{
+			domain.NewClientMessage(w.renderHourly(loc, weather, locationTime, hours, units), command.Sender(), command.Private()),
+		}, nil
+	}
+
+	reply := Reply{
+		Text(fmt.Sprintf("Showing weather for %s, %s", loc.name, loc.country)),
+		Field{Name: "Current", Value: fmt.Sprintf("%0.1f°%s - %s", units.convert(weather.Current.Temperature), units, weather.Current.Sky)},
+	}
+	if args.bool("details") {
+		reply = append(reply, conditionDetails(weather.Current, units)...)
+	}
+	sun := daylight{sunrise: weather.Sunrise, sunset: weather.Sunset}
+	if sun.sunrise.IsZero() || sun.sunset.IsZero() {
+		sun = sunTimes(locationTime, loc.latitude, loc.longitude)
+	}
+	reply = append(reply, Field{Name: "Sun", Value: sun.describe()})
+	for _, day := range weather.Days {
+		reply = append(reply, Field{Name: day.Date.Weekday().String(), Value: fmt.Sprintf("%0.1f°%s to %0.1f°%s -- %s", units.convert(day.Min), units, units.convert(day.Max), units, day.Sky)})
 	}
 	return []*domain.ClientMessage{
-		domain.NewClientMessage(text, command.Sender(), command.Private()),
+		domain.NewClientMessage(reply.Render(w.renderer), command.Sender(), command.Private()),
 	}, nil
 }
+
+// conditionDetails are the fields detailing the conditions beyond the temperature and the sky
+func conditionDetails(conditions Conditions, units degree) []Element {
+	wind := units.speed(conditions.WindSpeed)
+	if conditions.WindSpeed > 0 {
+		wind += " from the " + compassDirection(conditions.WindDirection)
+	}
+	if conditions.WindGust > conditions.WindSpeed {
+		wind += ", gusts up to " + units.speed(conditions.WindGust)
+	}
+	return []Element{
+		Field{Name: "Feels like", Value: fmt.Sprintf("%0.1f°%s", units.convert(conditions.FeelsLike), units)},
+		Field{Name: "Wind", Value: wind},
+		Field{Name: "Humidity", Value: fmt.Sprintf("%0.0f%%", conditions.Humidity)},
+		Field{Name: "Pressure", Value: units.pressure(conditions.Pressure)},
+		Field{Name: "Visibility", Value: units.distance(conditions.Visibility)},
+		Field{Name: "Clouds", Value: fmt.Sprintf("%0.0f%%", conditions.Clouds)},
+	}
+}
+
+// parseHours parses a number of hours written like 12h
+func parseHours(arg string) (int, bool) {
+	if !strings.HasSuffix(arg, "h") {
+		return 0, false
+	}
+	hours, err := strconv.Atoi(strings.TrimSuffix(arg, "h"))
+	return hours, err == nil
+}
+
+// renderHourly shows the forecast slots of the coming hours, from the one now is in
+func (w *WeatherCommand) renderHourly(loc *location, weather *Forecast, now time.Time, hours int, units degree) string {
+	from := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location())
+	until := now.Add(time.Duration(hours) * time.Hour)
+	var slots []HourForecast
+	for _, hour := range weather.Hours {
+		if !hour.Time.Before(from) && !hour.Time.After(until) {
+			slots = append(slots, hour)
+		}
+	}
+	reply := Reply{Text(fmt.Sprintf("Showing the weather of the next %dh for %s, %s", hours, loc.name, loc.country))}
+	if len(slots) == 0 {
+		return append(reply, Text("No hourly forecast available")).Render(w.renderer)
+	}
+	step := (len(slots) + maxHourlySlots - 1) / maxHourlySlots
+	for i := 0; i < len(slots); i += step {
+		slot := slots[i]
+		name := slot.Time.Format("15:04")
+		if slot.Time.YearDay() != now.YearDay() {
+			name = slot.Time.Format("Mon 15:04")
+		}
+		reply = append(reply, Field{
+			Name:  name,
+			Value: fmt.Sprintf("%0.1f°%s, %.0f%% precip. -- %s", units.convert(slot.Temperature), units, slot.PrecipitationProbability*100, slot.Sky),
+		})
+	}
+	return reply.Render(w.renderer)
+}
@@ -0,0 +1,163 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"github.com/raf924/connector-sdk/domain"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWeatherCommand(t *testing.T) {
+	server, executor := newServer(t)
+	weather := &pkg.WeatherCommand{}
+	initCommand(t, weather, executor)
+	assertTexts(t, run(t, weather, servicetest.NewUser("alice"), "paris", false),
+		"Showing weather for Paris, France\n"+
+			"Current: 11.9°C - clear sky\n"+
+			"Sun: rises at 08:15, sets at 18:55, 10h40m of daylight\n"+
+			"Monday: 5.6°C to 17.4°C -- few clouds - broken clouds - light rain - overcast clouds\n"+
+			"Tuesday: 5.2°C to 17.0°C -- overcast clouds - clear sky - few clouds\n"+
+			"Wednesday: 4.8°C to 16.6°C -- broken clouds - light rain - overcast clouds\n"+
+			"Thursday: 4.4°C to 16.2°C -- overcast clouds - clear sky - few clouds - broken clouds")
+	if requests := server.Requests("openmeteo"); len(requests) != 0 {
+		t.Errorf("openmeteo requests = %v, want none while openweather answers", requests)
+	}
+}
+
+func TestWeatherCommandUnknownCity(t *testing.T) {
+	server, executor := newServer(t)
+	server.Handle(servicetest.EmptyFixtures()...)
+	weather := &pkg.WeatherCommand{}
+	initCommand(t, weather, executor)
+	assertTexts(t, run(t, weather, servicetest.NewUser("alice"), "nowhere", false), "Could not find \"nowhere\"")
+}
+
+func TestWeatherCommandFallsBackToOpenMeteo(t *testing.T) {
+	server, executor := newServer(t)
+	server.Fail("openweather", http.StatusServiceUnavailable)
+	weather := &pkg.WeatherCommand{}
+	initCommand(t, weather, executor)
+	assertTexts(t, run(t, weather, servicetest.NewUser("alice"), "paris", false),
+		"Showing weather for Paris, France\n"+
+			"Current: 13.4°C - overcast\n"+
+			"Sun: rises at 08:15, sets at 18:55, 10h40m of daylight\n"+
+			"Monday: 10.2°C to 14.8°C -- slight rain\n"+
+			"Tuesday: 8.7°C to 13.9°C -- slight rain showers\n"+
+			"Wednesday: 7.9°C to 15.2°C -- partly cloudy\n"+
+			"Thursday: 8.8°C to 17.0°C -- mainly clear")
+	requests := server.Requests("openmeteo")
+	if len(requests) != 1 || requests[0].Query().Get("forecast_days") != "5" {
+		t.Errorf("openmeteo requests = %v, want a 5 days forecast", requests)
+	}
+}
+
+func TestWeatherCommandWithoutApiKey(t *testing.T) {
+	server, executor := newServer(t)
+	delete(executor.Keys, "openweather")
+	weather := &pkg.WeatherCommand{}
+	initCommand(t, weather, executor)
+	run(t, weather, servicetest.NewUser("alice"), "paris", false)
+	if requests := server.Requests("openweather"); len(requests) != 0 {
+		t.Errorf("openweather requests = %v, want none without an API key", requests)
+	}
+	if requests := server.Requests("openmeteo"); len(requests) != 1 {
+		t.Errorf("openmeteo requests = %v, want the forecast asked to Open-Meteo", requests)
+	}
+}
+
+func TestWeatherCommandHourly(t *testing.T) {
+	_, executor := newServer(t)
+	weather := &pkg.WeatherCommand{}
+	initCommand(t, weather, executor)
+	assertTexts(t, run(t, weather, servicetest.NewUser("alice"), "paris 6h", false),
+		"Showing the weather of the next 6h for Paris, France\n"+
+			"11:00: 11.9°C, 0% precip. -- clear sky\n"+
+			"14:00: 15.3°C, 13% precip. -- clear sky")
+}
+
+func TestWeatherCommandHourlyShorthands(t *testing.T) {
+	_, executor := newServer(t)
+	weather := &pkg.WeatherCommand{}
+	initCommand(t, weather, executor)
+	alice := servicetest.NewUser("alice")
+	if texts := run(t, weather, alice, "--hourly paris", false); len(texts) != 1 || !strings.HasPrefix(texts[0], "Showing the weather of the next 12h for Paris, France\n") {
+		t.Errorf("texts = %q, want the next 12h by default", texts)
+	}
+	if texts := run(t, weather, alice, "paris 12h f", false); len(texts) != 1 || !strings.HasPrefix(texts[0], "Showing the weather of the next 12h for Paris, France\n11:00: 53.3°F") {
+		t.Errorf("texts = %q, want the next 12h in Fahrenheit", texts)
+	}
+	assertTexts(t, run(t, weather, alice, "paris 72h", false), "The hourly forecast goes from 1h to 48h")
+}
+
+func TestWeatherCommandDetails(t *testing.T) {
+	_, executor := newServer(t)
+	weather := &pkg.WeatherCommand{}
+	initCommand(t, weather, executor)
+	assertTexts(t, run(t, weather, servicetest.NewUser("alice"), "--details paris f", false),
+		"Showing weather for Paris, France\n"+
+			"Current: 53.3°F - clear sky\n"+
+			"Feels like: 51.2°F\n"+
+			"Wind: 7 mph from the N, gusts up to 11 mph\n"+
+			"Humidity: 70%\n"+
+			"Pressure: 29.97 inHg\n"+
+			"Visibility: 6.2 mi\n"+
+			"Clouds: 0%\n"+
+			"Sun: rises at 08:15, sets at 18:55, 10h40m of daylight\n"+
+			"Monday: 42.0°F to 63.2°F -- few clouds - broken clouds - light rain - overcast clouds\n"+
+			"Tuesday: 41.3°F to 62.5°F -- overcast clouds - clear sky - few clouds\n"+
+			"Wednesday: 40.5°F to 61.8°F -- broken clouds - light rain - overcast clouds\n"+
+			"Thursday: 39.8°F to 61.1°F -- overcast clouds - clear sky - few clouds - broken clouds")
+}
+
+func TestWeatherCommandDetailsFromOpenMeteo(t *testing.T) {
+	server, executor := newServer(t)
+	server.Fail("openweather", http.StatusServiceUnavailable)
+	weather := &pkg.WeatherCommand{}
+	initCommand(t, weather, executor)
+	texts := run(t, weather, servicetest.NewUser("alice"), "-d paris", false)
+	want := "Showing weather for Paris, France\n" +
+		"Current: 13.4°C - overcast\n" +
+		"Feels like: 11.9°C\n" +
+		"Wind: 15 km/h from the WSW, gusts up to 33 km/h\n" +
+		"Humidity: 78%\n" +
+		"Pressure: 1013 hPa\n" +
+		"Visibility: 24.1 km\n" +
+		"Clouds: 100%\n"
+	if len(texts) != 1 || !strings.HasPrefix(texts[0], want) {
+		t.Errorf("texts = %q, want the details in metric units", texts)
+	}
+}
+
+func TestWeatherCommandAlertSubscriptions(t *testing.T) {
+	_, executor := newServer(t)
+	executor.Permissions = func(user *domain.User, permission domain.Permission) bool {
+		return user.Nick() == "moderator"
+	}
+	weather := &pkg.WeatherCommand{}
+	initCommand(t, weather, executor)
+	alice, bob := servicetest.NewUser("alice"), servicetest.NewUser("bob")
+	assertTexts(t, run(t, weather, alice, "subscribe paris", false), "Watching Paris, France, severe weather will be announced here")
+	assertTexts(t, run(t, weather, alice, "subscribe paris", false), "Already watching Paris, France")
+	assertTexts(t, run(t, weather, bob, "subscribe", false), "Weather alerts for:\n- Paris, France")
+	assertTexts(t, run(t, weather, bob, "unsubscribe", false), "Which location? e.g. !weather unsubscribe paris")
+	assertTexts(t, run(t, weather, bob, "unsubscribe berlin", false), "Not watching \"berlin\"")
+	assertTexts(t, run(t, weather, bob, "unsubscribe par", false),
+		"Only who subscribed to Paris, France or a moderator can unsubscribe from it")
+	assertTexts(t, run(t, weather, servicetest.NewUser("moderator"), "unsubscribe par", false), "No more alerts for Paris, France")
+
+	assertTexts(t, run(t, weather, bob, "subscribe paris", true), "Watching Paris, France, severe weather will be announced here")
+	assertTexts(t, run(t, weather, alice, "subscribe", true), "Not watching any location, use !weather subscribe <city>")
+	assertTexts(t, run(t, weather, bob, "unsubscribe paris", true), "No more alerts for Paris, France")
+}
+
+func TestWeatherCommandOnChatWithoutAlerts(t *testing.T) {
+	_, executor := newServer(t)
+	weather := &pkg.WeatherCommand{}
+	initCommand(t, weather, executor)
+	messages, err := weather.OnChat(servicetest.NewChatMessage(servicetest.NewUser("alice"), "hello", false))
+	if err != nil || len(messages) != 0 {
+		t.Errorf("OnChat() = %q, %v, want nothing", servicetest.Texts(messages), err)
+	}
+}
@@ -1,20 +1,30 @@
 package pkg
 
 import (
+	"context"
 	"encoding/xml"
-	"errors"
-	"fmt"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
-	"log"
-	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 var _ command.Command = (*WikiCommand)(nil)
+var _ Helper = (*WikiCommand)(nil)
+var _ ContextExecutable = (*WikiCommand)(nil)
+
+const (
+	wikiTimeout     = 10 * time.Second
+	wikiCacheTTL    = 24 * time.Hour
+	wikipediaDomain = ".wikipedia.org"
+)
+
+var wikiOptions = []commandOption{
+	{name: "lang", short: "l"},
+}
 
 type WikiSearchResponse struct {
 	XMLName xml.Name `xml:"api"`
@@ -48,18 +58,48 @@ type WikiExtractResponse struct {
 	} `xml:"query"`
 }
 
+// wikiSettings are the settings of WikiCommand coming from the Config
+type wikiSettings struct {
+	wikiUrl *url.URL
+	// lang is the default language of the articles, the one of the endpoint if empty
+	lang string
+}
+
 type WikiCommand struct {
 	command.NoOpInterceptor
-	wikiUrl *url.URL
+	current  atomic.Value
+	client   *httpClient
+	renderer Renderer
+	trigger  string
 }
 
-func (w *WikiCommand) Init(command.Executor) error {
-	wikiUrl, err := url.Parse("https://en.wikipedia.org/w/api.php?action=query&format=xml")
+func (w *WikiCommand) Init(executor command.Executor) error {
+	if err := setUp(executor); err != nil {
+		return err
+	}
+	var err error
+	w.client = newHttpClient(wikiTimeout, defaultMaxBodySize)
+	w.trigger = executor.Trigger()
+	w.renderer, err = rendererFor(executor)
 	if err != nil {
 		return err
 	}
-	w.wikiUrl = wikiUrl
-	return nil
+	return configureCommand(w, executor)
+}
+
+func (w *WikiCommand) configure(config commandConfig) (func(), error) {
+	baseUrl, err := config.endpoint(wikipediaUpstream)
+	if err != nil {
+		return nil, err
+	}
+	wikiUrl := endpointUrl(baseUrl, "w", "api.php")
+	wikiUrl.RawQuery = "action=query&format=xml"
+	settings := &wikiSettings{wikiUrl: wikiUrl, lang: config.Wiki.Lang}
+	return func() { w.current.Store(settings) }, nil
+}
+
+func (w *WikiCommand) settings() *wikiSettings {
+	return w.current.Load().(*wikiSettings)
 }
 
 func (w *WikiCommand) Name() string {
@@ -70,100 +110,142 @@ func (w *WikiCommand) Aliases() []string {
 	return []string{}
 }
 
-func (w *WikiCommand) search(search string) (*WikiSearchResponse, error) {
-	queryURL := *w.wikiUrl
+func (w *WikiCommand) Usage() string {
+	return "<subject> " + optionsUsage(wikiOptions)
+}
+
+func (w *WikiCommand) Description() string {
+	return "Summarizes the Wikipedia article about a subject"
+}
+
+func (w *WikiCommand) Examples() []string {
+	return []string{"alan turing", "--lang=fr tour eiffel"}
+}
+
+func (w *WikiCommand) upstreams() []string {
+	return []string{wikipediaUpstream}
+}
+
+// apiUrl returns the URL of the API of the Wikipedia in lang, the configured one if lang is empty
+// or if the endpoint is not a Wikipedia one
+func (w *WikiCommand) apiUrl(lang string) url.URL {
+	apiUrl := *w.settings().wikiUrl
+	if len(lang) > 0 && strings.HasSuffix(apiUrl.Host, wikipediaDomain) {
+		apiUrl.Host = strings.ToLower(strings.SplitN(strings.Replace(lang, "_", "-", 1), "-", 2)[0]) + wikipediaDomain
+	}
+	return apiUrl
+}
+
+func (w *WikiCommand) search(ctx context.Context, lang string, search string) (*WikiSearchResponse, error) {
+	queryURL := w.apiUrl(lang)
 	wikiQuery := queryURL.Query()
 	wikiQuery.Set("srsearch", search)
 	wikiQuery.Set("list", "search")
 	queryURL.RawQuery = wikiQuery.Encode()
-	netClient := http.Client{Timeout: time.Second * 30}
-	log.Println(queryURL.String())
-	wikiRequest, err := http.NewRequest(http.MethodGet, queryURL.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	response, err := netClient.Do(wikiRequest)
-	if err != nil {
-		return nil, err
-	}
 	var searchResponse WikiSearchResponse
-	err = xml.NewDecoder(response.Body).Decode(&searchResponse)
+	err := cached(cacheKey(wikipediaUpstream, queryURL.Host, "search", search), wikiCacheTTL, &searchResponse, func() error {
+		return w.client.getXML(ctx, queryURL.String(), &searchResponse)
+	})
 	if err != nil {
-		return nil, err
+		return nil, upstreamError(wikipediaUpstream, err)
 	}
 	return &searchResponse, nil
 }
 
-func (w *WikiCommand) info(pageId int) (*WikiInfoResponse, error) {
+func (w *WikiCommand) info(ctx context.Context, lang string, pageId int) (*WikiInfoResponse, error) {
 	var infoResponse WikiInfoResponse
-	infoUrl := *w.wikiUrl
+	infoUrl := w.apiUrl(lang)
 	wikiQuery := infoUrl.Query()
 	wikiQuery.Set("prop", "info")
 	wikiQuery.Set("inprop", "url")
 	wikiQuery.Set("pageids", strconv.Itoa(pageId))
 	infoUrl.RawQuery = wikiQuery.Encode()
-	wikiRequest, err := http.NewRequest(http.MethodGet, infoUrl.String(), nil)
+	err := cached(cacheKey(wikipediaUpstream, infoUrl.Host, "info", strconv.Itoa(pageId)), wikiCacheTTL, &infoResponse, func() error {
+		return w.client.getXML(ctx, infoUrl.String(), &infoResponse)
+	})
 	if err != nil {
-		return nil, err
-	}
-	netClient := http.Client{Timeout: time.Second * 30}
-	resp, err := netClient.Do(wikiRequest)
-	if err != nil {
-		return nil, err
-	}
-	err = xml.NewDecoder(resp.Body).Decode(&infoResponse)
-	if err != nil {
-		return nil, err
+		return nil, upstreamError(wikipediaUpstream, err)
 	}
 	return &infoResponse, nil
 }
 
-func (w *WikiCommand) extract(pageId int) (*WikiExtractResponse, error) {
+func (w *WikiCommand) extract(ctx context.Context, lang string, pageId int) (*WikiExtractResponse, error) {
 	var extractResponse WikiExtractResponse
-	extractUrl := *w.wikiUrl
+	extractUrl := w.apiUrl(lang)
 	wikiQuery := extractUrl.Query()
 	wikiQuery.Set("prop", "extracts")
 	wikiQuery.Set("explaintext", "")
 	wikiQuery.Set("exintro", "")
 	wikiQuery.Set("pageids", strconv.Itoa(pageId))
 	extractUrl.RawQuery = wikiQuery.Encode()
-	wikiRequest, err := http.NewRequest(http.MethodGet, extractUrl.String(), nil)
+	err := cached(cacheKey(wikipediaUpstream, extractUrl.Host, "extract", strconv.Itoa(pageId)), wikiCacheTTL, &extractResponse, func() error {
+		return w.client.getXML(ctx, extractUrl.String(), &extractResponse)
+	})
 	if err != nil {
-		return nil, err
+		return nil, upstreamError(wikipediaUpstream, err)
 	}
-	netClient := http.Client{Timeout: time.Second * 30}
-	resp, err := netClient.Do(wikiRequest)
+	return &extractResponse, nil
+}
+
+// page fetches the summary of the article with pageId
+func (w *WikiCommand) page(ctx context.Context, lang string, title string, pageId int) (Reply, error) {
+	extractResponse, err := w.extract(ctx, lang, pageId)
 	if err != nil {
 		return nil, err
 	}
-	err = xml.NewDecoder(resp.Body).Decode(&extractResponse)
+	infoResponse, err := w.info(ctx, lang, pageId)
 	if err != nil {
 		return nil, err
 	}
-	return &extractResponse, nil
+	if len(extractResponse.Query.Pages) == 0 || len(infoResponse.Query.Pages) == 0 {
+		return nil, notFound("No article found for %q", title)
+	}
+	summary := extractResponse.Query.Pages[0].Page.Extract
+	link := infoResponse.Query.Pages[0].Page.Url
+	return Reply{Link{Text: title, Url: link}, Quote(summary)}, nil
 }
 
 func (w *WikiCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
-	searchResponse, err := w.search(strings.Join(command.Args(), " "))
+	return execute(w, command)
+}
+
+func (w *WikiCommand) ExecuteContext(ctx context.Context, command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	args, err := parseArgs(command.ArgString(), wikiOptions...)
 	if err != nil {
 		return nil, err
 	}
-	if len(searchResponse.Query.Suggestion) == 0 {
-		return nil, errors.New("no result")
+	search := args.text()
+	if len(search) == 0 {
+		return nil, badInput("What should I look up?")
 	}
-	extractResponse, err := w.extract(searchResponse.Query.Suggestion[0].PageId)
+	lang := w.settings().lang
+	if prefs := preferencesOf(command.Sender()); len(prefs.Lang) > 0 {
+		lang = prefs.Lang
+	}
+	lang = args.string("lang", lang)
+	if len(lang) > 0 && !languagePattern.MatchString(lang) {
+		return nil, badInput("%q is not a language, e.g. fr", lang)
+	}
+	searchResponse, err := w.search(ctx, lang, search)
 	if err != nil {
 		return nil, err
 	}
-	infoResponse, err := w.info(searchResponse.Query.Suggestion[0].PageId)
+	if len(searchResponse.Query.Suggestion) == 0 {
+		return nil, notFound("No article found for %q", search)
+	}
+	first, err := w.page(ctx, lang, searchResponse.Query.Suggestion[0].Title, searchResponse.Query.Suggestion[0].PageId)
 	if err != nil {
 		return nil, err
 	}
-	title := searchResponse.Query.Suggestion[0].Title
-	summary := extractResponse.Query.Pages[0].Page.Extract
-	link := infoResponse.Query.Pages[0].Page.Url
-	reply := fmt.Sprintf("[%s](%s)\n>%s", title, link, summary)
+	var others []page
+	for _, suggestion := range searchResponse.Query.Suggestion[1:] {
+		title, pageId := suggestion.Title, suggestion.PageId
+		others = append(others, func(ctx context.Context) (Reply, error) {
+			return w.page(ctx, lang, title, pageId)
+		})
+	}
+	reply := paginate(command, w.trigger, first, others, wikipediaUpstream)
 	return []*domain.ClientMessage{
-		domain.NewClientMessage(reply, command.Sender(), command.Private()),
+		domain.NewClientMessage(reply.Render(w.renderer), command.Sender(), command.Private()),
 	}, nil
 }
@@ -0,0 +1,32 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"testing"
+)
+
+func TestWikiCommand(t *testing.T) {
+	server, executor := newServer(t)
+	wiki := &pkg.WikiCommand{}
+	initCommand(t, wiki, executor)
+	assertTexts(t, run(t, wiki, servicetest.NewUser("alice"), "golang", false),
+		"Go (programming language) (https://en.wikipedia.org/wiki/Go_(programming_language))\n"+
+			"  Go is a high-level general purpose programming language that is statically typed and compiled. "+
+			"It is known for the simplicity of its syntax and the efficiency of development that it enables.\n"+
+			"  It was designed at Google in 2007 by Robert Griesemer, Rob Pike, and Ken Thompson, and publicly announced in November 2009.\n"+
+			"(2 more, use !more)")
+	if requests := server.Requests("wikipedia"); len(requests) == 0 || requests[0].Query().Get("srsearch") != "golang" {
+		t.Errorf("wikipedia requests = %v, want golang searched first", requests)
+	}
+}
+
+func TestWikiCommandNotFound(t *testing.T) {
+	server, executor := newServer(t)
+	server.Handle(servicetest.EmptyFixtures()...)
+	wiki := &pkg.WikiCommand{}
+	initCommand(t, wiki, executor)
+	alice := servicetest.NewUser("alice")
+	assertTexts(t, run(t, wiki, alice, "zzzz", false), "No article found for \"zzzz\"")
+	assertTexts(t, run(t, wiki, alice, "", false), "What should I look up?")
+}
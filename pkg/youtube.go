@@ -2,65 +2,126 @@ package pkg
 
 import (
 	"context"
-	"fmt"
 	"github.com/gocolly/colly/v2"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	"google.golang.org/api/youtube/v3"
-	"log"
+	"net/url"
 	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 var _ command.Command = (*YoutubeCommand)(nil)
+var _ Helper = (*YoutubeCommand)(nil)
+var _ ContextInterceptor = (*YoutubeCommand)(nil)
+
+const (
+	youtubeTimeout = 10 * time.Second
+	// watch pages are much heavier than API responses
+	youtubeMaxBodySize = 8 << 20
+	youtubeCacheTTL    = 24 * time.Hour
+)
 
 var ytRegex = regexp.MustCompile(`(?i)(?:youtube\.com/\S*(?:(?:/e(?:mbed))?/|watch\?(?:\S*?&?v=))|youtu\.be/)([a-zA-Z0-9_-]{6,11})`)
 
+// youtubeSettings are the settings of YoutubeCommand coming from the Config
+type youtubeSettings struct {
+	getter   func(ctx context.Context, videoId string) (string, error)
+	apiKey   string
+	apiUrl   *url.URL
+	watchUrl *url.URL
+}
+
 type YoutubeCommand struct {
 	command.NoOpInterceptor
-	getter func(videoId string) (string, error)
-	apiKey string
+	current  atomic.Value
+	client   *httpClient
+	renderer Renderer
 }
 
-func (y *YoutubeCommand) getByApi(videoId string) (string, error) {
-	yS, err := youtube.NewService(context.Background(), option.WithAPIKey(y.apiKey))
+func (y *YoutubeCommand) getByApi(ctx context.Context, videoId string) (string, error) {
+	settings := y.settings()
+	yS, err := youtube.NewService(ctx, option.WithHTTPClient(y.client.client), option.WithEndpoint(settings.apiUrl.String()))
 	if err != nil {
-		log.Println(err)
-		return y.getByScraping(videoId)
+		loggerFrom(ctx).Warn("cannot create youtube service, scraping instead", "err", err)
+		return y.getByScraping(ctx, videoId)
 	}
-	resp, err := yS.Videos.List([]string{"snippet"}).Id(videoId).Do()
+	// the API key option is ignored when providing a client, so it has to be passed along with the call
+	resp, err := yS.Videos.List([]string{"snippet"}).Id(videoId).Context(ctx).Do(googleapi.QueryParameter("key", settings.apiKey))
 	if err != nil {
-		log.Println(err)
-		return y.getByScraping(videoId)
+		loggerFrom(ctx).Warn("youtube api call failed, scraping instead", "err", err)
+		return y.getByScraping(ctx, videoId)
 	}
 	if len(resp.Items) == 0 {
-		return "", fmt.Errorf("no video found with id: %s", videoId)
+		return "", notFound("No video found with id: %s", videoId)
 	}
 	return resp.Items[0].Snippet.Title, nil
 }
 
-func (y *YoutubeCommand) getByScraping(videoId string) (string, error) {
-	titleChan := make(chan string)
-	c := colly.NewCollector()
+func (y *YoutubeCommand) getByScraping(ctx context.Context, videoId string) (string, error) {
+	var title string
+	c := colly.NewCollector(colly.UserAgent(userAgent), colly.MaxBodySize(int(y.client.maxBodySize)))
+	c.WithTransport(&contextTransport{ctx: ctx, base: y.client.client.Transport})
+	c.SetRequestTimeout(y.client.client.Timeout)
 	c.OnHTML(".ytp-title-link", func(element *colly.HTMLElement) {
-		titleChan <- element.Text
+		if len(title) == 0 {
+			title = element.Text
+		}
 	})
-	err := c.Visit(fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoId))
+	watchUrl := endpointUrl(y.settings().watchUrl, "watch")
+	watchUrl.RawQuery = url.Values{"v": []string{videoId}}.Encode()
+	err := c.Visit(watchUrl.String())
 	if err != nil {
-		return "", err
+		return "", upstreamError(youtubeUpstream, err)
+	}
+	if len(title) == 0 {
+		return "", notFound("No title found for video with id: %s", videoId)
 	}
-	return <-titleChan, nil
+	return title, nil
 }
 
 func (y *YoutubeCommand) Init(bot command.Executor) error {
-	apiKey, ok := bot.ApiKeys()["youtube"]
-	if !ok || len(apiKey) == 0 {
-		y.getter = y.getByScraping
+	if err := setUp(bot); err != nil {
+		return err
+	}
+	var err error
+	y.client = newHttpClient(youtubeTimeout, youtubeMaxBodySize)
+	y.renderer, err = rendererFor(bot)
+	if err != nil {
+		return err
+	}
+	return configureCommand(y, bot)
+}
+
+func (y *YoutubeCommand) configure(config commandConfig) (func(), error) {
+	settings := &youtubeSettings{apiKey: config.apiKey("youtube")}
+	var err error
+	settings.watchUrl, err = config.endpoint(youtubeUpstream)
+	if err != nil {
+		return nil, err
+	}
+	settings.apiUrl, err = config.endpoint(youtubeApiUpstream)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(settings.apiUrl.Path, "/") {
+		// the API client resolves its paths relatively to the endpoint
+		settings.apiUrl.Path += "/"
+	}
+	if len(settings.apiKey) == 0 {
+		settings.getter = y.getByScraping
 	} else {
-		y.getter = y.getByApi
-		y.apiKey = apiKey
+		settings.getter = y.getByApi
 	}
-	return nil
+	return func() { y.current.Store(settings) }, nil
+}
+
+func (y *YoutubeCommand) settings() *youtubeSettings {
+	return y.current.Load().(*youtubeSettings)
 }
 
 func (y *YoutubeCommand) Name() string {
@@ -71,15 +132,50 @@ func (y *YoutubeCommand) Aliases() []string {
 	return []string{"yt"}
 }
 
+func (y *YoutubeCommand) Usage() string {
+	return ""
+}
+
+func (y *YoutubeCommand) Description() string {
+	return "Gives the title of the YouTube videos linked in the chat"
+}
+
+func (y *YoutubeCommand) Examples() []string {
+	return []string{"have you seen https://www.youtube.com/watch?v=dQw4w9WgXcQ"}
+}
+
+func (y *YoutubeCommand) watchesChat() bool {
+	return true
+}
+
+func (y *YoutubeCommand) upstreams() []string {
+	return []string{youtubeUpstream, youtubeApiUpstream}
+}
+
 func (y *YoutubeCommand) Execute(*domain.CommandMessage) ([]*domain.ClientMessage, error) {
 	return nil, nil
 }
 
 func (y *YoutubeCommand) OnChat(message *domain.ChatMessage) ([]*domain.ClientMessage, error) {
+	// only messages with a link are worth an invocation
 	if !ytRegex.MatchString(message.Message()) {
 		return nil, nil
 	}
-	title, err := y.getter(ytRegex.FindAllStringSubmatch(message.Message(), -1)[0][1])
+	return onChat(y, message)
+}
+
+func (y *YoutubeCommand) OnChatContext(ctx context.Context, message *domain.ChatMessage) ([]*domain.ClientMessage, error) {
+	if !ytRegex.MatchString(message.Message()) {
+		return nil, nil
+	}
+	videoId := ytRegex.FindAllStringSubmatch(message.Message(), -1)[0][1]
+	var title string
+	// video ids are case-sensitive so the key must not go through cacheKey
+	err := cached(youtubeUpstream+"|"+videoId, youtubeCacheTTL, &title, func() error {
+		var err error
+		title, err = y.settings().getter(ctx, videoId)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -88,7 +184,7 @@ func (y *YoutubeCommand) OnChat(message *domain.ChatMessage) ([]*domain.ClientMe
 		recipient = message.Sender()
 	}
 	return []*domain.ClientMessage{
-		domain.NewClientMessage(fmt.Sprintf("Video: %s", title), recipient, message.Private()),
+		domain.NewClientMessage(Reply{Field{Name: "Video", Value: title}}.Render(y.renderer), recipient, message.Private()),
 	}, nil
 }
 
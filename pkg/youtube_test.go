@@ -0,0 +1,56 @@
+package pkg_test
+
+import (
+	"github.com/raf924/bot-services-cmd/v2/pkg"
+	"github.com/raf924/bot-services-cmd/v2/pkg/servicetest"
+	"testing"
+)
+
+func TestYoutubeCommand(t *testing.T) {
+	server, executor := newServer(t)
+	youtube := &pkg.YoutubeCommand{}
+	initCommand(t, youtube, executor)
+	messages, err := youtube.OnChat(servicetest.NewChatMessage(servicetest.NewUser("alice"), "look https://www.youtube.com/watch?v=dQw4w9WgXcQ", false))
+	if err != nil {
+		t.Fatalf("OnChat() error = %v", err)
+	}
+	assertTexts(t, servicetest.Texts(messages), "Video: Rick Astley - Never Gonna Give You Up (Official Music Video)")
+	if messages[0].Recipient() != nil {
+		t.Errorf("recipient = %v, want the public channel", messages[0].Recipient())
+	}
+	if requests := server.Requests("youtubeapi"); len(requests) != 1 || requests[0].Query().Get("id") != "dQw4w9WgXcQ" {
+		t.Errorf("youtubeapi requests = %v, want the video asked once", requests)
+	}
+}
+
+func TestYoutubeCommandScrapesWithoutApiKey(t *testing.T) {
+	server, executor := newServer(t)
+	delete(executor.Keys, "youtube")
+	youtube := &pkg.YoutubeCommand{}
+	initCommand(t, youtube, executor)
+	alice := servicetest.NewUser("alice")
+	messages, err := youtube.OnChat(servicetest.NewChatMessage(alice, "https://youtu.be/dQw4w9WgXcQ", true))
+	if err != nil {
+		t.Fatalf("OnChat() error = %v", err)
+	}
+	assertTexts(t, servicetest.Texts(messages), "Video: Rick Astley - Never Gonna Give You Up (Official Music Video)")
+	if messages[0].Recipient() != alice || !messages[0].Private() {
+		t.Errorf("message to %v, private %v, want a private answer to alice", messages[0].Recipient(), messages[0].Private())
+	}
+	if requests := server.Requests("youtubeapi"); len(requests) != 0 {
+		t.Errorf("youtubeapi requests = %v, want none without an API key", requests)
+	}
+}
+
+func TestYoutubeCommandIgnoresMessagesWithoutLink(t *testing.T) {
+	server, executor := newServer(t)
+	youtube := &pkg.YoutubeCommand{}
+	initCommand(t, youtube, executor)
+	messages, err := youtube.OnChat(servicetest.NewChatMessage(servicetest.NewUser("alice"), "no video here", false))
+	if err != nil || len(messages) != 0 {
+		t.Errorf("OnChat() = %q, %v, want nothing", servicetest.Texts(messages), err)
+	}
+	if requests := append(server.Requests("youtube"), server.Requests("youtubeapi")...); len(requests) != 0 {
+		t.Errorf("requests = %v, want none", requests)
+	}
+}